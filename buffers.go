@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"github.com/montanaflynn/stats"
+	"sort"
+)
+
+// IOStats contains the buffer usage & I/O timing of a query, as reported
+// by EXPLAIN (BUFFERS) for the root node of its plan. The values of the
+// root node include those of all its child nodes.
+type IOStats struct {
+	SharedHitBlocks     int64   `json:"Shared Hit Blocks"`
+	SharedReadBlocks    int64   `json:"Shared Read Blocks"`
+	SharedDirtiedBlocks int64   `json:"Shared Dirtied Blocks"`
+	SharedWrittenBlocks int64   `json:"Shared Written Blocks"`
+	TempReadBlocks      int64   `json:"Temp Read Blocks"`
+	TempWrittenBlocks   int64   `json:"Temp Written Blocks"`
+	IOReadTimeMs        float64 `json:"I/O Read Time"`
+	IOWriteTimeMs       float64 `json:"I/O Write Time"`
+	WALRecords          int64   `json:"WAL Records"`
+	WALBytes            int64   `json:"WAL Bytes"`
+}
+
+// ioCounters returns the counters of the I/O stats by name, in the order
+// they are reported.
+func (s *IOStats) ioCounters() []struct {
+	name  string
+	value float64
+} {
+	return []struct {
+		name  string
+		value float64
+	}{
+		{"shared_hit_blocks", float64(s.SharedHitBlocks)},
+		{"shared_read_blocks", float64(s.SharedReadBlocks)},
+		{"shared_dirtied_blocks", float64(s.SharedDirtiedBlocks)},
+		{"shared_written_blocks", float64(s.SharedWrittenBlocks)},
+		{"temp_read_blocks", float64(s.TempReadBlocks)},
+		{"temp_written_blocks", float64(s.TempWrittenBlocks)},
+		{"io_read_time_ms", s.IOReadTimeMs},
+		{"io_write_time_ms", s.IOWriteTimeMs},
+		{"wal_records", float64(s.WALRecords)},
+		{"wal_bytes", float64(s.WALBytes)},
+	}
+}
+
+// IOCounterStats summarizes a single I/O counter across all queries
+type IOCounterStats struct {
+	Name  string  `json:"name"`
+	Total float64 `json:"total"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	Max   float64 `json:"max"`
+}
+
+// IOReport aggregates the I/O stats of all successful queries.
+type IOReport struct {
+	Queries int `json:"queries"`
+	// ColdQueries is the number of queries that read at least 1 block
+	// from disk (or the OS cache) instead of shared buffers
+	ColdQueries int `json:"cold_queries"`
+	// HitRatio is the fraction of shared blocks found in shared buffers
+	HitRatio float64           `json:"hit_ratio"`
+	Counters []*IOCounterStats `json:"counters"`
+}
+
+// newIOReport aggregates the I/O stats of the successful results.
+// It returns nil if no I/O stats were captured.
+func newIOReport(results []*Result) (*IOReport, error) {
+	r := &IOReport{}
+	values := make(map[string][]float64)
+	names := make([]string, 0)
+
+	for _, res := range results {
+		if res.Err != nil || res.IO == nil {
+			continue
+		}
+		r.Queries++
+		if res.IO.SharedReadBlocks > 0 {
+			r.ColdQueries++
+		}
+		for _, c := range res.IO.ioCounters() {
+			if _, ok := values[c.name]; !ok {
+				names = append(names, c.name)
+			}
+			values[c.name] = append(values[c.name], c.value)
+		}
+	}
+	if r.Queries == 0 {
+		return nil, nil
+	}
+
+	for _, n := range names {
+		v := values[n]
+		c := &IOCounterStats{Name: n}
+		var err error
+		if c.Total, err = stats.Sum(v); err != nil {
+			return nil, fmt.Errorf("failed to calculate total %s: %v", n, err)
+		}
+		if c.Mean, err = stats.Mean(v); err != nil {
+			return nil, fmt.Errorf("failed to calculate mean %s: %v", n, err)
+		}
+		if c.Max, err = stats.Max(v); err != nil {
+			return nil, fmt.Errorf("failed to calculate max %s: %v", n, err)
+		}
+
+		sorted := append([]float64(nil), v...)
+		sort.Float64s(sorted)
+		c.P50, c.P95 = nearestRank(sorted, 50), nearestRank(sorted, 95)
+		r.Counters = append(r.Counters, c)
+	}
+
+	hit, read := values["shared_hit_blocks"], values["shared_read_blocks"]
+	var totalHit, totalRead float64
+	for i := range hit {
+		totalHit += hit[i]
+		totalRead += read[i]
+	}
+	if totalHit+totalRead > 0 {
+		r.HitRatio = totalHit / (totalHit + totalRead)
+	}
+
+	return r, nil
+}
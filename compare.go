@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// defaultRegressionThreshold is the default increase (in %) of a metric
+// over the baseline beyond which it is considered to have regressed
+const defaultRegressionThreshold = 10
+
+// defaultSignificanceLevel is the default p-value below which the latency
+// distributions of 2 runs are considered to be different
+const defaultSignificanceLevel = 0.05
+
+// Absolute increases tolerated for metrics whose baseline is 0, for which
+// a relative threshold is meaningless, eg- a single failure in a run whose
+// baseline had none is not a regression.
+const (
+	latencyToleranceMs      = 1
+	failureRateTolerancePct = 0.1
+)
+
+// compareOptions control how a run is compared against a baseline
+type compareOptions struct {
+	// Threshold is the max tolerated increase (in %) of a metric
+	Threshold float64
+	// Alpha is the significance level of the Mann-Whitney U test. Latency
+	// regressions only count if the test finds the difference significant.
+	Alpha float64
+}
+
+// MetricDelta is the change in a metric between the baseline & current run
+type MetricDelta struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+	// DeltaPct is the change relative to the baseline, nil if the
+	// baseline is 0
+	DeltaPct *float64 `json:"delta_pct,omitempty"`
+	// HigherIsBetter is true for metrics like throughput
+	HigherIsBetter bool `json:"higher_is_better"`
+	Regressed      bool `json:"regressed"`
+}
+
+// HostDelta is the change in the latency of a host's queries
+type HostDelta struct {
+	Host            string   `json:"host"`
+	BaselineQueries int      `json:"baseline_queries"`
+	CurrentQueries  int      `json:"current_queries"`
+	BaselineP50     float64  `json:"baseline_p50_ms"`
+	CurrentP50      float64  `json:"current_p50_ms"`
+	BaselineP99     float64  `json:"baseline_p99_ms"`
+	CurrentP99      float64  `json:"current_p99_ms"`
+	P99DeltaPct     *float64 `json:"p99_delta_pct,omitempty"`
+	Regressed       bool     `json:"regressed"`
+}
+
+// MannWhitneyTest is the result of a Mann-Whitney U test of the latencies
+// of the baseline against those of the current run.
+type MannWhitneyTest struct {
+	U float64 `json:"u"`
+	Z float64 `json:"z"`
+	// PValue is the two-sided p-value based on the normal approximation
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+	// ProbSlower is the probability that a random query of the current run
+	// is slower than a random query of the baseline, 0.5 means no change
+	ProbSlower float64 `json:"prob_slower"`
+}
+
+// Comparison contains the differences between a baseline & a current run
+type Comparison struct {
+	Threshold float64          `json:"threshold_pct"`
+	Alpha     float64          `json:"alpha"`
+	Metrics   []*MetricDelta   `json:"metrics"`
+	Hosts     []*HostDelta     `json:"hosts"`
+	Test      *MannWhitneyTest `json:"mann_whitney,omitempty"`
+	// Regressed is true if any metric regressed beyond the threshold
+	Regressed bool `json:"regressed"`
+}
+
+// newMetricDelta computes the change of a metric & whether it regressed
+// by more than threshold %, or by more than tolerance if the baseline is 0.
+func newMetricDelta(metric string, baseline, current float64, higherIsBetter bool, threshold, tolerance float64) *MetricDelta {
+	d := &MetricDelta{
+		Metric:         metric,
+		Baseline:       baseline,
+		Current:        current,
+		Delta:          current - baseline,
+		HigherIsBetter: higherIsBetter,
+	}
+	worse := d.Delta
+	if higherIsBetter {
+		worse = -d.Delta
+	}
+	if baseline == 0 {
+		d.Regressed = worse > tolerance
+		return d
+	}
+	pct := d.Delta / math.Abs(baseline) * 100
+	d.DeltaPct = &pct
+	d.Regressed = worse/math.Abs(baseline)*100 > threshold
+	return d
+}
+
+// newComparison compares the current results against the baseline results.
+// Both must use the same timing mode, as given by latencyFn.
+func newComparison(baseline, current []*Result, latencyFn func(*Result) float64, opts compareOptions) (*Comparison, error) {
+	c := &Comparison{Threshold: opts.Threshold, Alpha: opts.Alpha}
+
+	baseLatencies, baseFailures := successfulLatencies(baseline, latencyFn)
+	curLatencies, curFailures := successfulLatencies(current, latencyFn)
+	if len(baseLatencies) == 0 || len(curLatencies) == 0 {
+		return nil, fmt.Errorf("both runs need successful queries to compare, got %d in the baseline & %d in the current run",
+			len(baseLatencies), len(curLatencies))
+	}
+
+	c.Test = mannWhitneyU(baseLatencies, curLatencies, opts.Alpha)
+
+	base, err := newLatencyStats(baseLatencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate baseline stats: %v", err)
+	}
+	cur, err := newLatencyStats(curLatencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate current stats: %v", err)
+	}
+
+	for _, m := range []struct {
+		name              string
+		baseline, current float64
+		// informational metrics are reported but never regress
+		informational bool
+	}{
+		{"mean_ms", base.Mean, cur.Mean, false},
+		{"p50_ms", base.P50, cur.P50, false},
+		{"p90_ms", base.P90, cur.P90, false},
+		{"p95_ms", base.P95, cur.P95, false},
+		{"p99_ms", base.P99, cur.P99, false},
+		// the max is a single query, too noisy to gate on
+		{"max_ms", base.Max, cur.Max, true},
+	} {
+		d := newMetricDelta(m.name, m.baseline, m.current, false, opts.Threshold, latencyToleranceMs)
+		// latency changes only count if they are statistically significant
+		d.Regressed = d.Regressed && c.Test.Significant && !m.informational
+		c.Metrics = append(c.Metrics, d)
+	}
+
+	c.Metrics = append(c.Metrics,
+		newMetricDelta("failure_rate_pct",
+			float64(baseFailures)*100/float64(len(baseline)), float64(curFailures)*100/float64(len(current)),
+			false, opts.Threshold, failureRateTolerancePct),
+	)
+	if bw, cw := runWindow(baseline), runWindow(current); bw > 0 && cw > 0 {
+		c.Metrics = append(c.Metrics, newMetricDelta("throughput_qps",
+			float64(len(baseline))/bw.Seconds(), float64(len(current))/cw.Seconds(), true, opts.Threshold, 0))
+	}
+
+	if c.Hosts, err = newHostDeltas(baseline, current, latencyFn, opts.Threshold); err != nil {
+		return nil, err
+	}
+
+	for _, m := range c.Metrics {
+		c.Regressed = c.Regressed || m.Regressed
+	}
+	return c, nil
+}
+
+// inferTimingMode determines how the latencies of results read from a
+// results file were measured: if none of the successful results has a
+// server processing time, queries were only timed by the client.
+func inferTimingMode(results []*Result) string {
+	for _, res := range results {
+		if res.Err == nil && res.TotalTimeMs() > 0 {
+			return timingServer
+		}
+	}
+	return timingClient
+}
+
+// successfulLatencies returns the latencies of the successful results
+// along with the number of failed results.
+func successfulLatencies(results []*Result, latencyFn func(*Result) float64) ([]float64, int) {
+	latencies := make([]float64, 0, len(results))
+	failures := 0
+	for _, res := range results {
+		if res.Err != nil {
+			failures++
+			continue
+		}
+		latencies = append(latencies, latencyFn(res))
+	}
+	return latencies, failures
+}
+
+// newHostDeltas compares the latency of every host present in both runs.
+// Hosts are sorted by their p99 change in descending order so that the
+// biggest regressions come first. Host regressions are informational & do
+// not count towards the regression of the run, as hosts usually have too
+// few queries for their p99 to be stable.
+func newHostDeltas(baseline, current []*Result, latencyFn func(*Result) float64, threshold float64) ([]*HostDelta, error) {
+	hostKey := func(res *Result) string { return res.Job.Hostname }
+	base, err := newGroupStats(baseline, hostKey, latencyFn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate baseline per-host stats: %v", err)
+	}
+	cur, err := newGroupStats(current, hostKey, latencyFn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate current per-host stats: %v", err)
+	}
+
+	baseByHost := make(map[string]*GroupStats, len(base))
+	for _, g := range base {
+		baseByHost[g.Name] = g
+	}
+
+	deltas := make([]*HostDelta, 0, len(cur))
+	for _, cg := range cur {
+		bg, ok := baseByHost[cg.Name]
+		if !ok || bg.Latency == nil || cg.Latency == nil {
+			continue
+		}
+		md := newMetricDelta("p99_ms", bg.Latency.P99, cg.Latency.P99, false, threshold, latencyToleranceMs)
+		deltas = append(deltas, &HostDelta{
+			Host:            cg.Name,
+			BaselineQueries: bg.Queries,
+			CurrentQueries:  cg.Queries,
+			BaselineP50:     bg.Latency.P50,
+			CurrentP50:      cg.Latency.P50,
+			BaselineP99:     bg.Latency.P99,
+			CurrentP99:      cg.Latency.P99,
+			P99DeltaPct:     md.DeltaPct,
+			Regressed:       md.Regressed,
+		})
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		di, dj := deltas[i].CurrentP99-deltas[i].BaselineP99, deltas[j].CurrentP99-deltas[j].BaselineP99
+		if deltas[i].P99DeltaPct != nil && deltas[j].P99DeltaPct != nil {
+			di, dj = *deltas[i].P99DeltaPct, *deltas[j].P99DeltaPct
+		}
+		if di != dj {
+			return di > dj
+		}
+		return deltas[i].Host < deltas[j].Host
+	})
+	return deltas, nil
+}
+
+// mannWhitneyU tests whether the current latencies tend to differ from the
+// baseline latencies, using the normal approximation with tie correction.
+func mannWhitneyU(baseline, current []float64, alpha float64) *MannWhitneyTest {
+	type sample struct {
+		value   float64
+		current bool
+	}
+	n1, n2 := float64(len(baseline)), float64(len(current))
+	samples := make([]sample, 0, len(baseline)+len(current))
+	for _, v := range baseline {
+		samples = append(samples, sample{v, false})
+	}
+	for _, v := range current {
+		samples = append(samples, sample{v, true})
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+
+	// assign ranks, averaging the ranks of ties
+	rankSum, tieTerm := 0.0, 0.0
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks start at 1
+		for k := i; k < j; k++ {
+			if samples[k].current {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankSum - n2*(n2+1)/2
+	t := &MannWhitneyTest{U: u, PValue: 1, ProbSlower: u / (n1 * n2)}
+
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance > 0 {
+		t.Z = (u - mean) / math.Sqrt(variance)
+		t.PValue = math.Erfc(math.Abs(t.Z) / math.Sqrt2)
+	}
+	t.Significant = t.PValue < alpha
+	return t
+}
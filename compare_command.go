@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+)
+
+var compareCommand = &cobra.Command{
+	Use:     "compare BASELINE CURRENT",
+	Short:   "Compare the results of 2 runs and detect regressions",
+	Args:    cobra.ExactArgs(2),
+	RunE:    compareHandler,
+	Example: "selectosaur compare before.csv after.csv --regression-threshold 5",
+	Long: `
+    Compare loads the results files of 2 previous runs (see --results-file)
+    and reports the change in latency, failure rate & throughput overall
+    and per host, along with a Mann-Whitney U test of the latencies.
+
+    It exits with a non-zero status if any metric regressed by more than
+    the threshold, so that it can gate CI. Latency regressions only count
+    if the Mann-Whitney U test finds the difference significant.`,
+}
+
+func init() {
+	compareCommand.SilenceErrors = true
+	compareCommand.SilenceUsage = true
+
+	addCompareFlags(compareCommand.Flags())
+
+	command.AddCommand(compareCommand)
+}
+
+// addCompareFlags adds the flags that control how runs are compared
+func addCompareFlags(flags *pflag.FlagSet) {
+	flags.Float64(
+		"regression-threshold", defaultRegressionThreshold,
+		"Max tolerated increase (in %) of latency & failure rate or decrease of throughput over the baseline",
+	)
+	flags.Float64(
+		"significance", defaultSignificanceLevel,
+		"p-value below which the Mann-Whitney U test considers latencies to differ",
+	)
+}
+
+// compareOptionsFromFlags reads the flags added by addCompareFlags
+func compareOptionsFromFlags(cmd *cobra.Command) (compareOptions, error) {
+	var opts compareOptions
+	opts.Threshold, _ = cmd.Flags().GetFloat64("regression-threshold")
+	opts.Alpha, _ = cmd.Flags().GetFloat64("significance")
+	if opts.Threshold < 0 {
+		return opts, errors.New("--regression-threshold cannot be negative")
+	}
+	if opts.Alpha <= 0 || opts.Alpha >= 1 {
+		return opts, errors.New("--significance must be between 0 and 1")
+	}
+	return opts, nil
+}
+
+// loadRun reads the results of a run from a results file, leaving out
+// warmup queries.
+func loadRun(path string) ([]*Result, error) {
+	results, err := readResultsFile(path)
+	if err != nil {
+		return nil, err
+	}
+	results, _ = splitWarmup(results)
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%s contains no results", path)
+	}
+	return results, nil
+}
+
+func compareHandler(cmd *cobra.Command, args []string) error {
+	opts, err := compareOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	outputFormat, _ := cmd.Flags().GetString("output-format")
+	if err := validateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+
+	baseline, err := loadRun(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to load baseline: %v", err)
+	}
+	current, err := loadRun(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to load current run: %v", err)
+	}
+
+	baseMode, curMode := inferTimingMode(baseline), inferTimingMode(current)
+	if baseMode != curMode {
+		return fmt.Errorf("cannot compare runs timed differently, the baseline was timed by the %s & the current run by the %s",
+			baseMode, curMode)
+	}
+
+	c, err := newComparison(baseline, current, primaryLatency(curMode), opts)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if outputFile, _ := cmd.Flags().GetString("output"); outputFile != "" {
+		if out, err = os.Create(outputFile); err != nil {
+			return fmt.Errorf("failed to create output file %s: %v", outputFile, err)
+		}
+		defer out.Close()
+	}
+	if err := c.Write(out, outputFormat); err != nil {
+		return fmt.Errorf("failed to write comparison: %v", err)
+	}
+
+	if c.Regressed {
+		return fmt.Errorf("performance regressed by more than %.2f%% compared to the baseline", opts.Threshold)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Write renders the comparison in the given format to w.
+func (c *Comparison) Write(w io.Writer, format string) error {
+	switch format {
+	case formatText:
+		writeComparisonText(w, c)
+		return nil
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case formatCSV:
+		rows := append([][]string{{"section", "key", "metric", "value"}}, comparisonRows(c)...)
+		if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+			return fmt.Errorf("failed to write CSV comparison: %v", err)
+		}
+		return nil
+	case formatMarkdown:
+		writeComparisonMarkdown(w, c)
+		return nil
+	}
+	return validateOutputFormat(format)
+}
+
+// formatDeltaPct formats a relative change, which is not available if
+// the baseline was 0
+func formatDeltaPct(pct *float64) string {
+	if pct == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.2f%%", *pct)
+}
+
+// regressionMark flags regressed metrics in tables
+func regressionMark(regressed bool) string {
+	if regressed {
+		return "REGRESSED"
+	}
+	return ""
+}
+
+// mannWhitneyMetrics returns the result of the significance test as metrics
+func mannWhitneyMetrics(t *MannWhitneyTest) []reportMetric {
+	return []reportMetric{
+		{"u", formatFloat(t.U)},
+		{"z", formatFloat(t.Z)},
+		{"p_value", formatFloat(t.PValue)},
+		{"significant", strconv.FormatBool(t.Significant)},
+		{"prob_slower", formatFloat(t.ProbSlower)},
+	}
+}
+
+// writeComparisonText prints the metric & host deltas as aligned tables
+func writeComparisonText(w io.Writer, c *Comparison) {
+	verdict := "no regression"
+	if c.Regressed {
+		verdict = "REGRESSION DETECTED"
+	}
+	fmt.Fprintf(w, "    Comparison with baseline (threshold %.2f%%): %s\n", c.Threshold, verdict)
+	if t := c.Test; t != nil {
+		significance := "not significant"
+		if t.Significant {
+			significance = "significant"
+		}
+		fmt.Fprintf(w, "      %-40s U=%.1f, z=%.3f, p=%.4f (%s at alpha %.2f)\n", "Mann-Whitney U test:",
+			t.U, t.Z, t.PValue, significance, c.Alpha)
+		fmt.Fprintf(w, "      %-40s %.2f%%\n", "Chance a query is now slower:", t.ProbSlower*100)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    Metric\tBaseline\tCurrent\tDelta\tDelta %\t\t")
+	for _, m := range c.Metrics {
+		fmt.Fprintf(tw, "    %s\t%f\t%f\t%+f\t%s\t%s\t\n",
+			m.Metric, m.Baseline, m.Current, m.Delta, formatDeltaPct(m.DeltaPct), regressionMark(m.Regressed))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	if len(c.Hosts) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "    Per-host comparison (sorted by p99 change):")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    Host\tQueries\tBaseline p50 (ms)\tCurrent p50 (ms)\tBaseline p99 (ms)\tCurrent p99 (ms)\tp99 delta %\t\t")
+	for _, h := range c.Hosts {
+		fmt.Fprintf(tw, "    %s\t%d/%d\t%f\t%f\t%f\t%f\t%s\t%s\t\n",
+			h.Host, h.BaselineQueries, h.CurrentQueries, h.BaselineP50, h.CurrentP50, h.BaselineP99, h.CurrentP99,
+			formatDeltaPct(h.P99DeltaPct), regressionMark(h.Regressed))
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// comparisonRows returns the comparison as (section, key, metric, value)
+// rows of the CSV output
+func comparisonRows(c *Comparison) [][]string {
+	rows := [][]string{
+		{"comparison", "", "threshold_pct", formatFloat(c.Threshold)},
+		{"comparison", "", "alpha", formatFloat(c.Alpha)},
+		{"comparison", "", "regressed", strconv.FormatBool(c.Regressed)},
+	}
+	if c.Test != nil {
+		for _, m := range mannWhitneyMetrics(c.Test) {
+			rows = append(rows, []string{"mann_whitney", "", m.name, m.value})
+		}
+	}
+	for _, m := range c.Metrics {
+		rows = append(rows,
+			[]string{"metric_delta", m.Metric, "baseline", formatFloat(m.Baseline)},
+			[]string{"metric_delta", m.Metric, "current", formatFloat(m.Current)},
+			[]string{"metric_delta", m.Metric, "delta", formatFloat(m.Delta)},
+		)
+		if m.DeltaPct != nil {
+			rows = append(rows, []string{"metric_delta", m.Metric, "delta_pct", formatFloat(*m.DeltaPct)})
+		}
+		rows = append(rows, []string{"metric_delta", m.Metric, "regressed", strconv.FormatBool(m.Regressed)})
+	}
+	for _, h := range c.Hosts {
+		rows = append(rows,
+			[]string{"host_delta", h.Host, "baseline_queries", strconv.Itoa(h.BaselineQueries)},
+			[]string{"host_delta", h.Host, "current_queries", strconv.Itoa(h.CurrentQueries)},
+			[]string{"host_delta", h.Host, "baseline_p50_ms", formatFloat(h.BaselineP50)},
+			[]string{"host_delta", h.Host, "current_p50_ms", formatFloat(h.CurrentP50)},
+			[]string{"host_delta", h.Host, "baseline_p99_ms", formatFloat(h.BaselineP99)},
+			[]string{"host_delta", h.Host, "current_p99_ms", formatFloat(h.CurrentP99)},
+		)
+		if h.P99DeltaPct != nil {
+			rows = append(rows, []string{"host_delta", h.Host, "p99_delta_pct", formatFloat(*h.P99DeltaPct)})
+		}
+		rows = append(rows, []string{"host_delta", h.Host, "regressed", strconv.FormatBool(h.Regressed)})
+	}
+	return rows
+}
+
+// writeComparisonMarkdown renders the comparison as markdown tables
+func writeComparisonMarkdown(w io.Writer, c *Comparison) {
+	fmt.Fprintln(w, "## Comparison with baseline")
+	fmt.Fprintln(w)
+	if c.Regressed {
+		fmt.Fprintf(w, "> **Regression detected** (threshold %.2f%%).\n\n", c.Threshold)
+	}
+	if c.Test != nil {
+		fmt.Fprintln(w, "| Mann-Whitney U | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range mannWhitneyMetrics(c.Test) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "| Metric | Baseline | Current | Delta | Delta % | Regressed |")
+	fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | --- |")
+	for _, m := range c.Metrics {
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %t |\n",
+			m.Metric, formatFloat(m.Baseline), formatFloat(m.Current), formatFloat(m.Delta), formatDeltaPct(m.DeltaPct), m.Regressed)
+	}
+
+	if len(c.Hosts) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Host | Queries | Baseline p50 (ms) | Current p50 (ms) | Baseline p99 (ms) | Current p99 (ms) | p99 delta % | Regressed |")
+	fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: | ---: | --- |")
+	for _, h := range c.Hosts {
+		fmt.Fprintf(w, "| %s | %d/%d | %s | %s | %s | %s | %s | %t |\n",
+			escapeMarkdown(h.Host), h.BaselineQueries, h.CurrentQueries,
+			formatFloat(h.BaselineP50), formatFloat(h.CurrentP50), formatFloat(h.BaselineP99), formatFloat(h.CurrentP99),
+			formatDeltaPct(h.P99DeltaPct), h.Regressed)
+	}
+}
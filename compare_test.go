@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewMetricDelta(t *testing.T) {
+	tests := []struct {
+		name           string
+		baseline       float64
+		current        float64
+		higherIsBetter bool
+		tolerance      float64
+		wantPct        *float64
+		wantRegressed  bool
+	}{
+		{name: "unchanged", baseline: 100, current: 100, wantPct: floatPtr(0)},
+		{name: "increase within threshold", baseline: 100, current: 110, wantPct: floatPtr(10)},
+		{name: "increase beyond threshold", baseline: 100, current: 111, wantPct: floatPtr(11), wantRegressed: true},
+		{name: "decrease", baseline: 100, current: 50, wantPct: floatPtr(-50)},
+		{name: "higher is better, decrease within threshold", baseline: 100, current: 95, higherIsBetter: true, wantPct: floatPtr(-5)},
+		{
+			name: "higher is better, decrease beyond threshold", baseline: 100, current: 80, higherIsBetter: true,
+			wantPct: floatPtr(-20), wantRegressed: true,
+		},
+		{name: "higher is better, increase", baseline: 100, current: 200, higherIsBetter: true, wantPct: floatPtr(100)},
+		{name: "zero baseline, unchanged", baseline: 0, current: 0, tolerance: 0.1},
+		{name: "zero baseline, increase within tolerance", baseline: 0, current: 0.05, tolerance: 0.1},
+		{name: "zero baseline, increase beyond tolerance", baseline: 0, current: 0.2, tolerance: 0.1, wantRegressed: true},
+		{name: "zero baseline, no tolerance", baseline: 0, current: 0.01, wantRegressed: true},
+		{name: "zero baseline, higher is better", baseline: 0, current: 5, higherIsBetter: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newMetricDelta("metric", tt.baseline, tt.current, tt.higherIsBetter, 10, tt.tolerance)
+			if d.Delta != tt.current-tt.baseline {
+				t.Errorf("delta = %v, want %v", d.Delta, tt.current-tt.baseline)
+			}
+			switch {
+			case tt.wantPct == nil && d.DeltaPct != nil:
+				t.Errorf("delta pct = %v, want nil", *d.DeltaPct)
+			case tt.wantPct != nil && d.DeltaPct == nil:
+				t.Errorf("delta pct = nil, want %v", *tt.wantPct)
+			case tt.wantPct != nil && math.Abs(*d.DeltaPct-*tt.wantPct) > 1e-9:
+				t.Errorf("delta pct = %v, want %v", *d.DeltaPct, *tt.wantPct)
+			}
+			if d.Regressed != tt.wantRegressed {
+				t.Errorf("regressed = %v, want %v", d.Regressed, tt.wantRegressed)
+			}
+		})
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		name            string
+		baseline        []float64
+		current         []float64
+		wantU           float64
+		wantZ           float64
+		wantPValue      float64
+		wantProbSlower  float64
+		wantSignificant bool
+	}{
+		{
+			name:     "identical",
+			baseline: []float64{1, 2, 3}, current: []float64{1, 2, 3},
+			wantU: 4.5, wantZ: 0, wantPValue: 1, wantProbSlower: 0.5,
+		},
+		{
+			name:     "all values tied",
+			baseline: []float64{5, 5, 5}, current: []float64{5, 5},
+			wantU: 3, wantZ: 0, wantPValue: 1, wantProbSlower: 0.5,
+		},
+		{
+			name:     "single samples",
+			baseline: []float64{1}, current: []float64{2},
+			wantU: 1, wantZ: 1, wantPValue: 0.317311, wantProbSlower: 1,
+		},
+		{
+			name:     "current slower",
+			baseline: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			current:  []float64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			wantU:    100, wantZ: 3.779645, wantPValue: 0.000157, wantProbSlower: 1, wantSignificant: true,
+		},
+		{
+			name:     "current faster",
+			baseline: []float64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			current:  []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			wantU:    0, wantZ: -3.779645, wantPValue: 0.000157, wantProbSlower: 0, wantSignificant: true,
+		},
+		{
+			name:     "interleaved",
+			baseline: []float64{1, 3, 5, 7}, current: []float64{2, 4, 6, 8},
+			wantU: 10, wantZ: 0.577350, wantPValue: 0.563703, wantProbSlower: 0.625,
+		},
+	}
+
+	const eps = 1e-6
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mannWhitneyU(tt.baseline, tt.current, 0.05)
+			if math.Abs(got.U-tt.wantU) > eps {
+				t.Errorf("U = %v, want %v", got.U, tt.wantU)
+			}
+			if math.Abs(got.Z-tt.wantZ) > eps {
+				t.Errorf("Z = %v, want %v", got.Z, tt.wantZ)
+			}
+			if math.Abs(got.PValue-tt.wantPValue) > eps {
+				t.Errorf("p-value = %v, want %v", got.PValue, tt.wantPValue)
+			}
+			if math.Abs(got.ProbSlower-tt.wantProbSlower) > eps {
+				t.Errorf("prob slower = %v, want %v", got.ProbSlower, tt.wantProbSlower)
+			}
+			if got.Significant != tt.wantSignificant {
+				t.Errorf("significant = %v, want %v", got.Significant, tt.wantSignificant)
+			}
+		})
+	}
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
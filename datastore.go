@@ -2,42 +2,195 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
+	"time"
 )
 
-// TODO: fix the seconds offset problem
-const timeSlicedCpuStatsQuery = `EXPLAIN (ANALYZE, FORMAT JSON)
-SELECT
-   time_bucket('1 minute', ts) AS clock, MAX(usage), MIN(usage)
-FROM cpu_usage
-WHERE
-   host = $1 AND ts BETWEEN $2 AND $3
-GROUP BY clock`
+// Timing modes determine how the latency of a query is measured
+const (
+	// timingServer uses the Planning & Execution time reported by
+	// EXPLAIN ANALYZE
+	timingServer = "server"
+	// timingClient measures the wall-clock time of running the actual
+	// query, including waiting for a pool connection, fetching & decoding
+	// the rows
+	timingClient = "client"
+	// timingBoth runs EXPLAIN ANALYZE followed by the actual query
+	timingBoth = "both"
+)
+
+var timingModes = []string{timingServer, timingClient, timingBoth}
+
+// explainOptions are the optional parameters of the EXPLAIN statement
+// prepended to every query template.
+type explainOptions struct {
+	// Buffers reports buffer usage & I/O timing
+	Buffers bool
+	// WAL reports WAL record generation, requires PostgreSQL 13+
+	WAL bool
+	// Settings reports non-default configuration parameters affecting the
+	// plan, requires PostgreSQL 12+
+	Settings bool
+}
+
+// prefix returns the EXPLAIN statement to prepend to a query so that
+// timescale reports the plan, planning & execution time of the query
+func (o explainOptions) prefix() string {
+	return o.statementPrefix(true, "JSON")
+}
+
+// statementPrefix returns the EXPLAIN statement to prepend to a query for
+// a plan in the given format, with or without actually running the query.
+func (o explainOptions) statementPrefix(analyze bool, format string) string {
+	opts := make([]string, 0, 5)
+	if analyze {
+		opts = append(opts, "ANALYZE")
+	}
+	if o.Buffers {
+		opts = append(opts, "BUFFERS")
+	}
+	if o.WAL {
+		opts = append(opts, "WAL")
+	}
+	if o.Settings {
+		opts = append(opts, "SETTINGS")
+	}
+	opts = append(opts, "FORMAT "+format)
+	return fmt.Sprintf("EXPLAIN (%s) ", strings.Join(opts, ", "))
+}
 
 // explainResult contains the response from an EXPLAIN ANALYZE query
 // run in timescale db.
 type explainResult struct {
-	PlanTimeMs float64 `json:"Planning Time"`
-	ExecTimeMs float64 `json:"Execution Time"`
+	Plan       planNode          `json:"Plan"`
+	PlanTimeMs float64           `json:"Planning Time"`
+	ExecTimeMs float64           `json:"Execution Time"`
+	Settings   map[string]string `json:"Settings"`
+	// raw is the unparsed JSON response
+	raw json.RawMessage
 }
 
 // Datastore interacts with a Timescale database.
 // It is thread-safe and is designed to be called by multiple goroutines
 // concurrently.
 type Datastore struct {
-	connPool *pgxpool.Pool
+	connPool   *pgxpool.Pool
+	timingMode string
+	explain    explainOptions
+	// queryTimeout is the deadline for measuring a single job, 0 means
+	// no deadline
+	queryTimeout time.Duration
+	// retry determines how queries failing with transient errors are retried
+	retry retryPolicy
+	// capturePlans records the raw EXPLAIN output of every query so that
+	// the plans of the slowest ones can be sampled
+	capturePlans bool
+}
+
+// validateTimingMode returns an error if the given timing mode is unknown
+func validateTimingMode(mode string) error {
+	for _, m := range timingModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported timing mode %s, must be one of: %s", mode, strings.Join(timingModes, ", "))
+}
+
+// Measure runs the given query template bound to the given query param
+// and records its latency in res, as per the timing mode of the datastore.
+// In "both" mode, the actual query is not run if EXPLAIN ANALYZE fails.
+// Transient errors are retried as per the retry policy of the datastore,
+// the number of retries made is recorded in res. The query timeout applies
+// to the job as a whole, ie, all attempts & the backoff between them.
+func (d *Datastore) Measure(ctx context.Context, tmpl *QueryTemplate, qp *QueryParameter, res *Result) error {
+	if d.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.queryTimeout)
+		defer cancel()
+	}
+
+	retries, err := d.retry.run(ctx, func() error { return d.measure(ctx, tmpl, qp, res) })
+	res.Retries = retries
+	return err
 }
 
-// CPUStatsQueryExecTime returns the total processing time for the query
-// that computes cpu stats at 1-min intervals for the given query param.
-// Processing time here is the sum of Planning time & Execution time
-// returned by EXPLAIN ANALYZE for the query
+// measure makes a single attempt at measuring the query
+func (d *Datastore) measure(ctx context.Context, tmpl *QueryTemplate, qp *QueryParameter, res *Result) error {
+	if d.timingMode != timingClient {
+		er, err := d.ExplainQuery(ctx, tmpl, qp)
+		if err != nil {
+			return err
+		}
+		res.PlanTimeMs, res.ExecTimeMs = er.PlanTimeMs, er.ExecTimeMs
+		res.Plan = summarizePlan(&er.Plan)
+		res.Plan.Settings = er.Settings
+		if d.explain.Buffers || d.explain.WAL {
+			io := er.Plan.IOStats
+			res.IO = &io
+		}
+		if d.capturePlans {
+			res.RawPlan = er.raw
+		}
+	}
+
+	if d.timingMode != timingServer {
+		t, err := d.QueryWallClockTime(ctx, tmpl, qp)
+		if err != nil {
+			return err
+		}
+		res.ClientTimeMs = t
+	}
+
+	return nil
+}
+
+// ExplainQuery runs EXPLAIN ANALYZE for the given query template bound to
+// the given query param and returns the plan along with the Planning time
+// & Execution time reported by the database
 // (see https://www.postgresql.org/docs/9.4/using-explain.html).
-func (d *Datastore) CPUStatsQueryExecTime(ctx context.Context, qp *QueryParameter) (float64, error) {
+func (d *Datastore) ExplainQuery(ctx context.Context, tmpl *QueryTemplate, qp *QueryParameter) (*explainResult, error) {
+	var raw []byte
+	row := d.connPool.QueryRow(ctx, d.explain.prefix()+tmpl.SQL, tmpl.Args(qp)...)
+	if err := row.Scan(&raw); err != nil {
+		return nil, err
+	}
+
 	var res []explainResult
-	row := d.connPool.QueryRow(ctx, timeSlicedCpuStatsQuery, qp.Hostname, qp.StartTime, qp.EndTime)
-	if err := row.Scan(&res); err != nil {
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse EXPLAIN output: %v", err)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("EXPLAIN returned no plan")
+	}
+	res[0].raw = raw
+	return &res[0], nil
+}
+
+// QueryWallClockTime runs the given query template bound to the given
+// query param and returns the time (in ms) taken from acquiring a pool
+// connection until all rows of the result have been fetched & decoded.
+func (d *Datastore) QueryWallClockTime(ctx context.Context, tmpl *QueryTemplate, qp *QueryParameter) (float64, error) {
+	start := time.Now()
+
+	rows, err := d.connPool.Query(ctx, tmpl.SQL, tmpl.Args(qp)...)
+	if err != nil {
 		return 0, err
 	}
-	return res[0].ExecTimeMs + res[0].PlanTimeMs, nil
+	defer rows.Close()
+
+	for rows.Next() {
+		if _, err := rows.Values(); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return durationMs(time.Since(start)), nil
 }
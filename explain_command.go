@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var explainCommand = &cobra.Command{
+	Use:     "explain --qp FILE",
+	Short:   "Print the plan of a query for a single query param",
+	Args:    cobra.NoArgs,
+	RunE:    explainHandler,
+	Example: "selectosaur explain --qp /tmp/query_params.csv --row 42 --explain-buffers",
+	Long: `
+    Explain runs EXPLAIN ANALYZE for the query template bound to a single
+    record of the query params CSV and prints the plan, which is handy to
+    dig into an outlier reported by a run.
+
+    The plan is printed as text, or as JSON with --output-format json.
+    Use --analyze=false to only plan the query without running it.`,
+}
+
+func init() {
+	addQueryFlags(explainCommand)
+	addExplainFlags(explainCommand.Flags())
+	explainCommand.Flags().Int("row", 1, "Number of the query params CSV record to explain, starting at 1")
+	explainCommand.Flags().Bool("analyze", true, "Run the query to report actual times & row counts")
+
+	command.AddCommand(explainCommand)
+}
+
+func explainHandler(cmd *cobra.Command, args []string) error {
+	mix, err := applyScenarioFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	if len(mix) > 0 {
+		return errors.New("explain cannot be used with a workload that mixes queries, use --qp & --query-file instead")
+	}
+
+	outputFormat, _ := cmd.Flags().GetString("output-format")
+	if outputFormat != formatText && outputFormat != formatJSON {
+		return fmt.Errorf("explain only supports the %s & %s output formats", formatText, formatJSON)
+	}
+
+	explain := explainOptionsFromFlags(cmd)
+	analyze, _ := cmd.Flags().GetBool("analyze")
+	if explain.WAL && !analyze {
+		return errors.New("--explain-wal requires --analyze")
+	}
+
+	tmpl, err := queryTemplateFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	_, params, err := queryParamsFromFlags(cmd, tmpl)
+	if err != nil {
+		return err
+	}
+	row, _ := cmd.Flags().GetInt("row")
+	if row < 1 || row > len(params) {
+		return fmt.Errorf("--row must be between 1 and %d", len(params))
+	}
+	qp := params[row-1]
+
+	connStr, err := connectionString(cmd)
+	if err != nil {
+		return err
+	}
+	dbPool, err := pgxpool.Connect(cmd.Context(), connStr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to timescale database: %v", err)
+	}
+	defer dbPool.Close()
+
+	out := os.Stdout
+	if outputFile, _ := cmd.Flags().GetString("output"); outputFile != "" {
+		if out, err = os.Create(outputFile); err != nil {
+			return fmt.Errorf("failed to create output file %s: %v", outputFile, err)
+		}
+		defer out.Close()
+	}
+
+	if outputFormat == formatJSON {
+		var raw json.RawMessage
+		err := dbPool.QueryRow(cmd.Context(), explain.statementPrefix(analyze, "JSON")+tmpl.SQL, tmpl.Args(qp)...).Scan(&raw)
+		if err != nil {
+			return fmt.Errorf("failed to explain query for %s: %v", qp, err)
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(&struct {
+			Template string            `json:"template"`
+			Params   map[string]string `json:"params"`
+			Plan     json.RawMessage   `json:"plan"`
+		}{tmpl.Name, qp.Fields, raw})
+	}
+
+	rows, err := dbPool.Query(cmd.Context(), explain.statementPrefix(analyze, "TEXT")+tmpl.SQL, tmpl.Args(qp)...)
+	if err != nil {
+		return fmt.Errorf("failed to explain query for %s: %v", qp, err)
+	}
+	defer rows.Close()
+
+	plan := make([]string, 0)
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("failed to read plan: %v", err)
+		}
+		plan = append(plan, line)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to explain query for %s: %v", qp, err)
+	}
+
+	fmt.Fprintf(out, "Query template: %s\nQuery param:    %s\n\n%s\n", tmpl.Name, qp, strings.Join(plan, "\n"))
+	return nil
+}
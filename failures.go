@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"os"
+	"sort"
+	"strings"
+)
+
+// noSQLState is the code under which failures that did not originate
+// from the database (eg- connection errors) are grouped.
+const noSQLState = "none"
+
+// sqlStateQueryCanceled is the SQLSTATE code of queries cancelled by the
+// server, eg- due to statement_timeout
+const sqlStateQueryCanceled = "57014"
+
+// Categories of failures
+const (
+	// failureTimeout is a query that exceeded --query-timeout, either on
+	// the client or via statement_timeout on the server
+	failureTimeout = "timeout"
+	// failureQuery is any other error reported by the database
+	failureQuery = "query_error"
+	// failureOther is an error that did not come from the database, eg-
+	// a network error
+	failureOther = "other"
+)
+
+// FailureGroup is a set of failures that have something in common, eg-
+// the same SQLSTATE code.
+type FailureGroup struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+	// Examples contains the query params of the first few failures
+	Examples []string `json:"examples"`
+}
+
+// FailureClassification groups failures in different ways so that
+// the most common causes of failure can be identified.
+type FailureClassification struct {
+	ByCategory []*FailureGroup `json:"by_category"`
+	ByCode     []*FailureGroup `json:"by_code"`
+	ByMessage  []*FailureGroup `json:"by_message"`
+	ByHost     []*FailureGroup `json:"by_host"`
+}
+
+// sqlState returns the SQLSTATE code of an error returned by the database,
+// or noSQLState if the error did not come from the database.
+func sqlState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return noSQLState
+}
+
+// isTimeout returns true if the error was caused by the query exceeding its
+// deadline on the client or statement_timeout on the server.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		pgErr.Code == sqlStateQueryCanceled && strings.Contains(pgErr.Message, "statement timeout")
+}
+
+// failureCategory returns the category of the error of a failed query
+func failureCategory(err error) string {
+	switch {
+	case isTimeout(err):
+		return failureTimeout
+	case sqlState(err) != noSQLState:
+		return failureQuery
+	default:
+		return failureOther
+	}
+}
+
+// classifyFailures groups the failed results by category, SQLSTATE code,
+// error message and host. Every group holds up to maxExamples example
+// query params.
+func classifyFailures(results []*Result, maxExamples int) *FailureClassification {
+	return &FailureClassification{
+		ByCategory: groupFailures(results, maxExamples, func(r *Result) string { return failureCategory(r.Err) }),
+		ByCode:     groupFailures(results, maxExamples, func(r *Result) string { return sqlState(r.Err) }),
+		ByMessage:  groupFailures(results, maxExamples, func(r *Result) string { return r.Err.Error() }),
+		ByHost:     groupFailures(results, maxExamples, func(r *Result) string { return r.Job.Hostname }),
+	}
+}
+
+// groupFailures groups the failed results by the key returned by keyFn.
+// Groups are sorted by their number of failures in descending order.
+func groupFailures(results []*Result, maxExamples int, keyFn func(*Result) string) []*FailureGroup {
+	groups := make(map[string]*FailureGroup)
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+		k := keyFn(res)
+		g, ok := groups[k]
+		if !ok {
+			g = &FailureGroup{Key: k, Examples: make([]string, 0, maxExamples)}
+			groups[k] = g
+		}
+		g.Count++
+		if len(g.Examples) < maxExamples {
+			g.Examples = append(g.Examples, res.Job.String())
+		}
+	}
+
+	sorted := make([]*FailureGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// writeFailuresFile writes the query params of all failed results to a CSV
+// file with the given header, so that the file can be supplied to --qp to
+// replay the failed queries. The SQLSTATE code & error message are added as
+// extra columns at the end of each record.
+func writeFailuresFile(path string, header []string, results []*Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(append(append([]string(nil), header...), "sqlstate", "error")); err != nil {
+		return fmt.Errorf("failed to write header to %s: %v", path, err)
+	}
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+		if err := w.Write(append(res.Job.Record(), sqlState(res.Err), res.Err.Error())); err != nil {
+			return fmt.Errorf("failed to write failed query param to %s: %v", path, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// writeQueryFailuresFiles writes the failures file of a run. Query types
+// have their own CSV headers, so if several were mixed, each one that
+// had failures gets a file of its own, named after it.
+func writeQueryFailuresFiles(path string, queries []*QueryType, results []*Result) error {
+	if len(queries) == 1 {
+		return writeFailuresFile(path, queries[0].Header, results)
+	}
+
+	for _, q := range queries {
+		qResults := queryResults(results, q.Template.Name)
+		for _, res := range qResults {
+			if res.Err == nil {
+				continue
+			}
+			if err := writeFailuresFile(queryTypePath(path, q.Template.Name), q.Header, qResults); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
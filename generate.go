@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Distributions of the length of the time windows of generated query params
+const (
+	windowFixed     = "fixed"
+	windowUniform   = "uniform"
+	windowLognormal = "lognormal"
+)
+
+var windowDistributions = []string{windowFixed, windowUniform, windowLognormal}
+
+// Access patterns of generated query params
+const (
+	// skewUniform picks hosts & time windows uniformly at random
+	skewUniform = "uniform"
+	// skewZipfian picks hosts as per Zipf's law, so a few hosts get most
+	// of the queries, the first host being the most popular
+	skewZipfian = "zipfian"
+	// skewRecentHeavy places time windows closer to the end of the time
+	// range with exponentially higher probability
+	skewRecentHeavy = "recent-heavy"
+)
+
+var skews = []string{skewUniform, skewZipfian, skewRecentHeavy}
+
+// paramTimeFormat is the format of the time range of query params
+const paramTimeFormat = "2006-01-02 15:04:05"
+
+// generateSpec describes a set of synthetic query params
+type generateSpec struct {
+	Count int
+	// Hosts is the number of distinct hosts, which are named by applying
+	// their number (starting at 0) to HostPattern
+	Hosts       int
+	HostPattern string
+	// Start & End bound the time windows of all query params
+	Start, End time.Time
+	// Window is the distribution of the length of time windows. The
+	// length is WindowLength if fixed, between WindowMin & WindowMax if
+	// uniform, and has a median of WindowLength & a standard deviation
+	// of WindowSigma on log scale if lognormal, clamped to WindowMin &
+	// WindowMax.
+	Window       string
+	WindowLength time.Duration
+	WindowMin    time.Duration
+	WindowMax    time.Duration
+	WindowSigma  float64
+	// Skew is the access pattern. ZipfExponent only applies to zipfian
+	// skew & RecentHalfLife to recent-heavy skew, where half of the time
+	// windows end within RecentHalfLife of End.
+	Skew           string
+	ZipfExponent   float64
+	RecentHalfLife time.Duration
+	Seed           int64
+}
+
+func oneOf(value string, choices []string) bool {
+	for _, c := range choices {
+		if c == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns an error if no query params can be generated as per
+// the spec.
+func (s *generateSpec) validate() error {
+	if s.Count < 1 {
+		return errors.New("--count must be positive")
+	}
+	if s.Hosts < 1 {
+		return errors.New("--hosts must be positive")
+	}
+	if h0, h1 := fmt.Sprintf(s.HostPattern, 0), fmt.Sprintf(s.HostPattern, 1); h0 == h1 || strings.Contains(h0, "%!") {
+		return fmt.Errorf("--host-pattern %s must contain a single integer verb, eg- host_%%06d", s.HostPattern)
+	}
+	if !s.End.After(s.Start) {
+		return errors.New("--end must be after --start")
+	}
+
+	if !oneOf(s.Window, windowDistributions) {
+		return fmt.Errorf("unsupported window distribution %s, must be one of: %s", s.Window, strings.Join(windowDistributions, ", "))
+	}
+	timeRange := s.End.Sub(s.Start)
+	switch {
+	case s.WindowLength < time.Second:
+		return errors.New("--window-length must be at least 1s")
+	case s.Window == windowFixed && s.WindowLength > timeRange:
+		return errors.New("--window-length cannot exceed the time range")
+	case s.Window != windowFixed && s.WindowMin < time.Second:
+		return errors.New("--window-min must be at least 1s")
+	case s.Window != windowFixed && s.WindowMin > s.WindowMax:
+		return errors.New("--window-min cannot exceed --window-max")
+	case s.Window != windowFixed && s.WindowMin > timeRange:
+		return errors.New("--window-min cannot exceed the time range")
+	case s.Window == windowLognormal && s.WindowSigma < 0:
+		return errors.New("--window-sigma cannot be negative")
+	}
+
+	if !oneOf(s.Skew, skews) {
+		return fmt.Errorf("unsupported skew %s, must be one of: %s", s.Skew, strings.Join(skews, ", "))
+	}
+	if s.Skew == skewZipfian && s.ZipfExponent <= 1 {
+		return errors.New("--zipf-exponent must be greater than 1")
+	}
+	if s.RecentHalfLife < 0 {
+		return errors.New("--recent-half-life cannot be negative")
+	}
+	return nil
+}
+
+// paramGenerator draws query params as per a spec. All times are in
+// whole seconds, the precision of paramTimeFormat.
+type paramGenerator struct {
+	spec *generateSpec
+	rng  *rand.Rand
+	zipf *rand.Zipf
+	// timeRange, windowMax & halfLife are in seconds
+	timeRange int64
+	windowMax int64
+	halfLife  float64
+}
+
+func newParamGenerator(spec *generateSpec) *paramGenerator {
+	g := &paramGenerator{
+		spec:      spec,
+		rng:       rand.New(rand.NewSource(spec.Seed)),
+		timeRange: int64(spec.End.Sub(spec.Start).Seconds()),
+		halfLife:  spec.RecentHalfLife.Seconds(),
+	}
+	g.windowMax = int64(spec.WindowMax.Seconds())
+	if g.windowMax > g.timeRange {
+		g.windowMax = g.timeRange
+	}
+	if g.halfLife == 0 {
+		g.halfLife = float64(g.timeRange) / 10
+	}
+	if spec.Skew == skewZipfian {
+		g.zipf = rand.NewZipf(g.rng, spec.ZipfExponent, 1, uint64(spec.Hosts-1))
+	}
+	return g
+}
+
+// host returns the name of a host
+func (g *paramGenerator) host() string {
+	var i int
+	if g.zipf != nil {
+		i = int(g.zipf.Uint64())
+	} else {
+		i = g.rng.Intn(g.spec.Hosts)
+	}
+	return fmt.Sprintf(g.spec.HostPattern, i)
+}
+
+// window returns the length of a time window in seconds
+func (g *paramGenerator) window() int64 {
+	min := int64(g.spec.WindowMin.Seconds())
+	switch g.spec.Window {
+	case windowUniform:
+		return min + g.rng.Int63n(g.windowMax-min+1)
+	case windowLognormal:
+		w := int64(math.Exp(math.Log(g.spec.WindowLength.Seconds()) + g.spec.WindowSigma*g.rng.NormFloat64()))
+		if w < min {
+			return min
+		}
+		if w > g.windowMax {
+			return g.windowMax
+		}
+		return w
+	}
+	return int64(g.spec.WindowLength.Seconds())
+}
+
+// start returns the start of a time window of the given length, as an
+// offset in seconds from the start of the time range.
+func (g *paramGenerator) start(window int64) int64 {
+	latest := g.timeRange - window
+	if g.spec.Skew != skewRecentHeavy {
+		return g.rng.Int63n(latest + 1)
+	}
+	if g.halfLife <= 0 {
+		return latest
+	}
+	// exponentially distributed distance from the latest possible start,
+	// with a median of the half-life, truncated to the time range by
+	// inverting its CDF over the range rather than wrapping long draws
+	// around to the recent end
+	lambda := math.Ln2 / g.halfLife
+	inRange := -math.Expm1(-lambda * float64(latest+1))
+	d := int64(-math.Log1p(-g.rng.Float64()*inRange) / lambda)
+	if d > latest {
+		d = latest
+	}
+	return latest - d
+}
+
+// next returns the record of a query param
+func (g *paramGenerator) next() []string {
+	host := g.host()
+	window := g.window()
+	start := g.spec.Start.Add(time.Duration(g.start(window)) * time.Second)
+	end := start.Add(time.Duration(window) * time.Second)
+	return []string{host, start.Format(paramTimeFormat), end.Format(paramTimeFormat)}
+}
+
+// generateParams writes query params drawn as per the spec to w as CSV
+func generateParams(w io.Writer, spec *generateSpec) error {
+	g := newParamGenerator(spec)
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"hostname", "start_time", "end_time"}); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+	for i := 0; i < spec.Count; i++ {
+		if err := cw.Write(g.next()); err != nil {
+			return fmt.Errorf("failed to write query param: %v", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"time"
+)
+
+var generateCommand = &cobra.Command{
+	Use:     "generate",
+	Short:   "Generate synthetic query params",
+	Args:    cobra.NoArgs,
+	RunE:    generateHandler,
+	Example: "selectosaur generate --count 10000 --hosts 4000 --skew zipfian --output query_params.csv",
+	Long: `
+    Generate writes a query params CSV with the given number of records,
+    drawn for a number of hosts named after a pattern, with time windows
+    within a time range.
+
+    The length of time windows is fixed, uniformly distributed or
+    lognormally distributed. Hosts & time windows are picked uniformly,
+    or skewed towards a few hosts (zipfian) or recent time windows
+    (recent-heavy). The same seed always generates the same query params.
+
+    The CSV is written to --output, or to stdout so that it can be
+    streamed straight into a run with --qp -, eg-
+
+    selectosaur generate --count 1000 | selectosaur run --qp -`,
+}
+
+func init() {
+	flags := generateCommand.Flags()
+	flags.Int("count", 1000, "Number of query params to generate")
+	flags.Int("hosts", 100, "Number of distinct hosts")
+	flags.String("host-pattern", "host_%06d", "Pattern of host names, applied to the host number starting at 0")
+	flags.String("start", "2017-01-01 00:00:00", "Start of the time range of the query params")
+	flags.String("end", "2017-01-02 00:00:00", "End of the time range of the query params")
+	flags.String(
+		"window", windowFixed,
+		fmt.Sprintf("Distribution of the length of time windows, one of: %s", strings.Join(windowDistributions, ", ")),
+	)
+	flags.Duration("window-length", time.Hour, "Length of time windows if fixed, or their median if lognormal")
+	flags.Duration("window-min", time.Minute, "Min length of time windows if uniform or lognormal")
+	flags.Duration("window-max", 6*time.Hour, "Max length of time windows if uniform or lognormal")
+	flags.Float64("window-sigma", 0.5, "Standard deviation of the log of the length of time windows if lognormal")
+	flags.String(
+		"skew", skewUniform,
+		fmt.Sprintf("Access pattern of the query params, one of: %s", strings.Join(skews, ", ")),
+	)
+	flags.Float64("zipf-exponent", 1.1, "Exponent of the zipfian skew, higher values concentrate queries on fewer hosts")
+	flags.Duration(
+		"recent-half-life", 0,
+		"Time from the end of the range within which half of the time windows end with recent-heavy skew (default: a tenth of the range)",
+	)
+	flags.Int64("seed", 0, "Seed of the random generator, for reproducible query params (default: random)")
+
+	command.AddCommand(generateCommand)
+}
+
+// parseParamTime parses a time in the format of query params, or RFC 3339
+func parseParamTime(s string) (time.Time, error) {
+	if t, err := time.Parse(paramTimeFormat, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func generateHandler(cmd *cobra.Command, args []string) error {
+	if outputFormat, _ := cmd.Flags().GetString("output-format"); outputFormat != formatText && outputFormat != formatCSV {
+		return fmt.Errorf("generate only supports the %s output format", formatCSV)
+	}
+
+	spec := &generateSpec{}
+	spec.Count, _ = cmd.Flags().GetInt("count")
+	spec.Hosts, _ = cmd.Flags().GetInt("hosts")
+	spec.HostPattern, _ = cmd.Flags().GetString("host-pattern")
+	spec.Window, _ = cmd.Flags().GetString("window")
+	spec.WindowLength, _ = cmd.Flags().GetDuration("window-length")
+	spec.WindowMin, _ = cmd.Flags().GetDuration("window-min")
+	spec.WindowMax, _ = cmd.Flags().GetDuration("window-max")
+	spec.WindowSigma, _ = cmd.Flags().GetFloat64("window-sigma")
+	spec.Skew, _ = cmd.Flags().GetString("skew")
+	spec.ZipfExponent, _ = cmd.Flags().GetFloat64("zipf-exponent")
+	spec.RecentHalfLife, _ = cmd.Flags().GetDuration("recent-half-life")
+	spec.Seed, _ = cmd.Flags().GetInt64("seed")
+	if !cmd.Flags().Changed("seed") {
+		spec.Seed = time.Now().UnixNano()
+	}
+
+	var err error
+	start, _ := cmd.Flags().GetString("start")
+	if spec.Start, err = parseParamTime(start); err != nil {
+		return fmt.Errorf("invalid --start: %v", err)
+	}
+	end, _ := cmd.Flags().GetString("end")
+	if spec.End, err = parseParamTime(end); err != nil {
+		return fmt.Errorf("invalid --end: %v", err)
+	}
+	if err := spec.validate(); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if outputFile, _ := cmd.Flags().GetString("output"); outputFile != "" {
+		if out, err = os.Create(outputFile); err != nil {
+			return fmt.Errorf("failed to create output file %s: %v", outputFile, err)
+		}
+		defer out.Close()
+	}
+	if err := generateParams(out, spec); err != nil {
+		return fmt.Errorf("failed to generate query params: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Generated %d query params for up to %d hosts with seed %d\n", spec.Count, spec.Hosts, spec.Seed)
+	return nil
+}
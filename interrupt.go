@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// interruptHandler cancels a run when the process receives SIGINT or
+// SIGTERM. Cancelling the run's context makes pgx send a cancel request
+// for every query in flight. Once the run is cancelled, default signal
+// handling is restored so that a second signal terminates the process.
+type interruptHandler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu            sync.Mutex
+	interruptedAt time.Time
+}
+
+// newInterruptHandler returns a handler whose context is derived from
+// parent and cancelled on SIGINT or SIGTERM. stop must be called to
+// release its resources.
+func newInterruptHandler(parent context.Context) *interruptHandler {
+	h := &interruptHandler{}
+	h.ctx, h.cancel = context.WithCancel(parent)
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		select {
+		case sig := <-sigCh:
+			h.mu.Lock()
+			h.interruptedAt = time.Now()
+			h.mu.Unlock()
+
+			fmt.Fprintf(os.Stderr, "\nReceived %v, cancelling outstanding queries (repeat to force quit)...\n", sig)
+			h.cancel()
+		case <-h.ctx.Done():
+		}
+	}()
+
+	return h
+}
+
+// Context returns the context of the run
+func (h *interruptHandler) Context() context.Context {
+	return h.ctx
+}
+
+// InterruptedAt returns the time at which the run was interrupted, or
+// the zero time if it wasn't.
+func (h *interruptHandler) InterruptedAt() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.interruptedAt
+}
+
+// stop releases the resources of the handler & restores default signal
+// handling.
+func (h *interruptHandler) stop() {
+	h.cancel()
+}
+
+// splitCancelled separates the results of queries that were cancelled
+// due to an interrupt from the rest, ie, the ones that failed after the
+// given time.
+func splitCancelled(results []*Result, interruptedAt time.Time) (completed, cancelled []*Result) {
+	if interruptedAt.IsZero() {
+		return results, nil
+	}
+
+	completed = make([]*Result, 0, len(results))
+	for _, res := range results {
+		if res.Err != nil && !res.EndTime.Before(interruptedAt) {
+			cancelled = append(cancelled, res)
+		} else {
+			completed = append(completed, res)
+		}
+	}
+	return completed, cancelled
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// loadOptions control how query params are fed to the worker pool.
+type loadOptions struct {
+	// Iterations is the number of times to cycle through the query params,
+	// 0 means no limit
+	Iterations int
+	// Duration is the time after which no more jobs are submitted, 0
+	// means no limit
+	Duration time.Duration
+	// Shuffle randomizes the order of query params in every iteration
+	Shuffle bool
+	Seed    int64
+	// Rate is the number of jobs to submit per second in open-loop mode,
+	// 0 means closed-loop, ie, jobs are submitted as fast as workers
+	// can take them
+	Rate float64
+	// WarmupJobs & WarmupDuration bound the warmup phase that precedes
+	// the measured run. The results of warmup jobs are excluded from the
+	// final stats. Only one of them is set, or neither if there's no warmup.
+	WarmupJobs     int
+	WarmupDuration time.Duration
+}
+
+// parseWarmup interprets the value of --warmup, which is either a number
+// of queries (eg- 100) or a duration (eg- 30s).
+func parseWarmup(s string) (jobs int, d time.Duration, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if jobs, err = strconv.Atoi(s); err == nil {
+		if jobs < 0 {
+			return 0, 0, fmt.Errorf("warmup query count cannot be negative")
+		}
+		return jobs, 0, nil
+	}
+	if d, err = time.ParseDuration(s); err != nil || d < 0 {
+		return 0, 0, fmt.Errorf("warmup must be a number of queries or a duration, got %s", s)
+	}
+	return 0, d, nil
+}
+
+// jobFeeder submits jobs to a queue, mixing query types as per their
+// weights, cycling through the query params of each and pacing jobs in
+// open-loop mode.
+type jobFeeder struct {
+	jobsQ   chan<- *Job
+	queries []*queryFeed
+	mixer   *queryMixer
+	rng     *rand.Rand
+	// interval is the time between scheduled jobs in open-loop mode
+	interval time.Duration
+	next     time.Time
+}
+
+// queryFeed cycles through the query params of a query type
+type queryFeed struct {
+	*QueryType
+	params []*QueryParameter
+	// pos is the index of the next query param to submit
+	pos int
+}
+
+// feedJobs submits the query params of the query types as jobs to the
+// queue, first for the warmup phase (if any) and then until either the
+// number of iterations or the duration is exhausted, or ctx is cancelled.
+// An iteration is as many jobs as there are query params in total.
+// It closes the queue before returning. At least one of Iterations and
+// Duration must be set, otherwise jobs are submitted indefinitely.
+//
+// In open-loop mode, jobs are scheduled at a constant rate regardless of
+// how fast they complete, and every job carries its scheduled start time.
+// If the queue is full, the schedule is not shifted, so the time spent
+// waiting for a free worker counts towards the latency of the job.
+func feedJobs(ctx context.Context, queries []*QueryType, jobsQ chan<- *Job, opts loadOptions) {
+	defer close(jobsQ)
+
+	f := &jobFeeder{jobsQ: jobsQ, mixer: newQueryMixer(queries), next: time.Now()}
+	if opts.Shuffle {
+		f.rng = rand.New(rand.NewSource(opts.Seed))
+	}
+	for _, q := range queries {
+		qf := &queryFeed{QueryType: q, params: q.Params}
+		if opts.Shuffle {
+			// shuffle a copy so that the caller's slice is left untouched
+			qf.params = append([]*QueryParameter(nil), q.Params...)
+		}
+		f.queries = append(f.queries, qf)
+	}
+	if opts.Rate > 0 {
+		f.interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+
+	if opts.WarmupJobs > 0 || opts.WarmupDuration > 0 {
+		if !f.feed(ctx, opts.WarmupJobs, opts.WarmupDuration, true) {
+			return
+		}
+		// start the measured run from the first query params
+		for _, q := range f.queries {
+			q.pos = 0
+		}
+		f.mixer.reset()
+	}
+	f.feed(ctx, opts.Iterations*totalParams(queries), opts.Duration, false)
+}
+
+// feed submits up to maxJobs jobs (0 means no limit) within the given
+// duration (0 means no limit). It returns false if ctx was cancelled.
+func (f *jobFeeder) feed(ctx context.Context, maxJobs int, d time.Duration, warmup bool) bool {
+	var deadline <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for n := 0; maxJobs == 0 || n < maxJobs; n++ {
+		q := f.queries[f.mixer.next()]
+		if q.pos%len(q.params) == 0 && f.rng != nil {
+			// reshuffle at the start of every iteration
+			f.rng.Shuffle(len(q.params), func(i, j int) { q.params[i], q.params[j] = q.params[j], q.params[i] })
+		}
+		job := &Job{QueryParameter: q.params[q.pos%len(q.params)], Template: q.Template, Warmup: warmup}
+		q.pos++
+
+		if f.interval > 0 {
+			// wait for the scheduled start of the job
+			select {
+			case <-time.After(time.Until(f.next)):
+			case <-deadline:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+			job.IntendedStart = f.next
+			f.next = f.next.Add(f.interval)
+		}
+
+		select {
+		case f.jobsQ <- job:
+		case <-deadline:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// splitWarmup separates the results of warmup jobs from the rest.
+func splitWarmup(results []*Result) (measured, warmup []*Result) {
+	measured = make([]*Result, 0, len(results))
+	for _, res := range results {
+		if res.Job.Warmup {
+			warmup = append(warmup, res)
+		} else {
+			measured = append(measured, res)
+		}
+	}
+	return measured, warmup
+}
+
+// runWindow returns the time between the start of the first & the end of
+// the last of the given results.
+func runWindow(results []*Result) time.Duration {
+	var first, last time.Time
+	for _, res := range results {
+		if first.IsZero() || res.StartTime.Before(first) {
+			first = res.StartTime
+		}
+		if res.EndTime.After(last) {
+			last = res.EndTime
+		}
+	}
+	return last.Sub(first)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxStartDelay is the p99 delay between the scheduled & actual start of
+// jobs beyond which the worker pool is considered to have fallen behind
+// the target rate in open-loop mode.
+const maxStartDelay = 100 * time.Millisecond
+
+// maxRate is the highest target rate (in jobs per second) in open-loop
+// mode. It keeps the interval between jobs well above the resolution of
+// time.Duration, which would otherwise round it down to 0.
+const maxRate = 1000000
+
+// maxBufferedJobs bounds the number of scheduled jobs buffered for busy
+// workers in open-loop mode, regardless of the target rate.
+const maxBufferedJobs = 10000
+
+// minAchievedRateRatio is the fraction of the target rate below which the
+// worker pool is considered to have fallen behind in open-loop mode.
+const minAchievedRateRatio = 0.95
+
+// OpenLoopStats describe how well a constant arrival rate was sustained
+// and how long queries waited for a free worker. The latency of queries
+// is measured from their scheduled start in open-loop mode, so the time
+// they spent waiting counts towards the latency stats of the report.
+type OpenLoopStats struct {
+	TargetRate   float64 `json:"target_rate_qps"`
+	AchievedRate float64 `json:"achieved_rate_qps"`
+	// StartDelay is the time between the scheduled start of a job and a
+	// worker starting to execute it
+	StartDelay *LatencyStats `json:"start_delay"`
+	// FellBehind is true if the pool could not keep up with the target rate
+	FellBehind bool `json:"fell_behind"`
+}
+
+// newOpenLoopStats computes the open-loop stats of the results of jobs
+// scheduled at the given target rate.
+func newOpenLoopStats(results []*Result, targetRate float64) (*OpenLoopStats, error) {
+	s := &OpenLoopStats{TargetRate: targetRate}
+	delays := make([]float64, 0, len(results))
+	var first, last time.Time
+
+	for _, res := range results {
+		intended := res.Job.IntendedStart
+		if intended.IsZero() {
+			continue
+		}
+		if first.IsZero() || intended.Before(first) {
+			first = intended
+		}
+		if res.StartTime.After(last) {
+			last = res.StartTime
+		}
+
+		delays = append(delays, durationMs(res.StartTime.Sub(intended)))
+	}
+	if len(delays) == 0 {
+		return nil, nil
+	}
+
+	if window := last.Sub(first); window > 0 {
+		s.AchievedRate = float64(len(delays)) / window.Seconds()
+	} else {
+		s.AchievedRate = targetRate
+	}
+
+	var err error
+	if s.StartDelay, err = newLatencyStats(delays); err != nil {
+		return nil, fmt.Errorf("failed to calculate start delay stats: %v", err)
+	}
+
+	s.FellBehind = s.AchievedRate < targetRate*minAchievedRateRatio ||
+		s.StartDelay.P99 > durationMs(maxStartDelay)
+
+	return s, nil
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// chunkAppendProvider is the name of the TimescaleDB custom scan node
+// that appends hypertable chunks and excludes them at execution time
+const chunkAppendProvider = "ChunkAppend"
+
+// decompressChunkProvider is the name of the TimescaleDB custom scan node
+// that decompresses a chunk, whose compressed data is scanned by its child
+const decompressChunkProvider = "DecompressChunk"
+
+// chunkRelationRegex matches the names of hypertable chunks, including
+// the chunks holding compressed data
+var chunkRelationRegex = regexp.MustCompile(`^(compress)?_hyper_\d+_\d+_chunk$`)
+
+// planNode is a node of the plan tree returned by EXPLAIN (FORMAT JSON)
+type planNode struct {
+	NodeType                string     `json:"Node Type"`
+	CustomPlanProvider      string     `json:"Custom Plan Provider"`
+	RelationName            string     `json:"Relation Name"`
+	ActualRows              float64    `json:"Actual Rows"`
+	ActualLoops             float64    `json:"Actual Loops"`
+	ChunksExcludedAtStartup int        `json:"Chunks excluded during startup"`
+	ChunksExcludedAtRuntime int        `json:"Chunks excluded during runtime"`
+	Plans                   []planNode `json:"Plans"`
+	// buffer usage, I/O timing & WAL usage are only reported by EXPLAIN
+	// with the BUFFERS & WAL options
+	IOStats
+}
+
+// name returns the node type, qualified by the plan provider for custom
+// scan nodes, eg- "Custom Scan (ChunkAppend)"
+func (n *planNode) name() string {
+	if n.CustomPlanProvider != "" {
+		return fmt.Sprintf("%s (%s)", n.NodeType, n.CustomPlanProvider)
+	}
+	return n.NodeType
+}
+
+// PlanSummary contains the facts of interest extracted from the plan
+// tree of a single query.
+type PlanSummary struct {
+	// NodeTypes counts the occurrences of every node type in the plan
+	NodeTypes map[string]int
+	// NodeRows & NodeLoops are the total actual rows & loops of every node type
+	NodeRows  map[string]float64
+	NodeLoops map[string]float64
+	// ChunksScanned is the number of distinct chunks that were scanned
+	ChunksScanned int
+	// ChunksExcluded is the number of chunks excluded by ChunkAppend
+	// during executor startup & runtime
+	ChunksExcluded int
+	ChunkAppend    bool
+	// Settings are the non-default configuration parameters that affected
+	// the plan, only reported by EXPLAIN with the SETTINGS option
+	Settings map[string]string
+}
+
+// summarizePlan walks the plan tree and summarizes it
+func summarizePlan(root *planNode) *PlanSummary {
+	s := &PlanSummary{
+		NodeTypes: make(map[string]int),
+		NodeRows:  make(map[string]float64),
+		NodeLoops: make(map[string]float64),
+	}
+
+	// a compressed chunk is scanned below the DecompressChunk node of the
+	// chunk it belongs to, so it is counted as that chunk
+	chunks := make(map[string]bool)
+	var walk func(n *planNode, decompressed bool)
+	walk = func(n *planNode, decompressed bool) {
+		name := n.name()
+		s.NodeTypes[name]++
+		// Actual Rows is the average per loop
+		s.NodeRows[name] += n.ActualRows * n.ActualLoops
+		s.NodeLoops[name] += n.ActualLoops
+
+		if n.CustomPlanProvider == chunkAppendProvider {
+			s.ChunkAppend = true
+			s.ChunksExcluded += n.ChunksExcludedAtStartup + n.ChunksExcludedAtRuntime
+		}
+		// chunk scans that were never executed have 0 loops
+		if chunkRelationRegex.MatchString(n.RelationName) && n.ActualLoops > 0 &&
+			!(decompressed && strings.HasPrefix(n.RelationName, "compress")) {
+			chunks[n.RelationName] = true
+		}
+
+		decompressed = decompressed || n.CustomPlanProvider == decompressChunkProvider
+		for i := range n.Plans {
+			walk(&n.Plans[i], decompressed)
+		}
+	}
+	walk(root, false)
+	s.ChunksScanned = len(chunks)
+
+	return s
+}
+
+// NodeTypeStats aggregates a node type across the plans of all queries
+type NodeTypeStats struct {
+	NodeType string `json:"node_type"`
+	// Queries is the number of queries whose plan contains the node type
+	Queries     int     `json:"queries"`
+	Occurrences int     `json:"occurrences"`
+	ActualRows  float64 `json:"actual_rows"`
+	ActualLoops float64 `json:"actual_loops"`
+}
+
+// PlanStats aggregates the plans of all successful queries.
+type PlanStats struct {
+	QueriesAnalyzed int `json:"queries_analyzed"`
+	// QueriesOverChunkThreshold is the number of queries which scanned
+	// more than ChunkThreshold chunks
+	ChunkThreshold            int     `json:"chunk_threshold"`
+	QueriesOverChunkThreshold int     `json:"queries_over_chunk_threshold"`
+	MinChunksScanned          int     `json:"min_chunks_scanned"`
+	MeanChunksScanned         float64 `json:"mean_chunks_scanned"`
+	MaxChunksScanned          int     `json:"max_chunks_scanned"`
+	ChunkAppendQueries        int     `json:"chunk_append_queries"`
+	// ExclusionQueries is the number of queries in which ChunkAppend
+	// excluded at least 1 chunk during executor startup or runtime
+	ExclusionQueries int              `json:"exclusion_queries"`
+	ChunksExcluded   int              `json:"chunks_excluded"`
+	NodeTypes        []*NodeTypeStats `json:"node_types"`
+	// Settings contains all non-default settings seen across plans
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// newPlanStats aggregates the plan summaries of the successful results.
+// It returns nil if no plans were captured.
+func newPlanStats(results []*Result, chunkThreshold int) *PlanStats {
+	ps := &PlanStats{ChunkThreshold: chunkThreshold, MinChunksScanned: -1}
+	nodeTypes := make(map[string]*NodeTypeStats)
+	totalChunks := 0
+
+	for _, res := range results {
+		p := res.Plan
+		if res.Err != nil || p == nil {
+			continue
+		}
+		ps.QueriesAnalyzed++
+
+		totalChunks += p.ChunksScanned
+		if p.ChunksScanned > chunkThreshold {
+			ps.QueriesOverChunkThreshold++
+		}
+		if ps.MinChunksScanned == -1 || p.ChunksScanned < ps.MinChunksScanned {
+			ps.MinChunksScanned = p.ChunksScanned
+		}
+		if p.ChunksScanned > ps.MaxChunksScanned {
+			ps.MaxChunksScanned = p.ChunksScanned
+		}
+		if p.ChunkAppend {
+			ps.ChunkAppendQueries++
+		}
+		if p.ChunksExcluded > 0 {
+			ps.ExclusionQueries++
+			ps.ChunksExcluded += p.ChunksExcluded
+		}
+		for k, v := range p.Settings {
+			if ps.Settings == nil {
+				ps.Settings = make(map[string]string)
+			}
+			ps.Settings[k] = v
+		}
+
+		for name, count := range p.NodeTypes {
+			nt, ok := nodeTypes[name]
+			if !ok {
+				nt = &NodeTypeStats{NodeType: name}
+				nodeTypes[name] = nt
+			}
+			nt.Queries++
+			nt.Occurrences += count
+			nt.ActualRows += p.NodeRows[name]
+			nt.ActualLoops += p.NodeLoops[name]
+		}
+	}
+
+	if ps.QueriesAnalyzed == 0 {
+		return nil
+	}
+	ps.MeanChunksScanned = float64(totalChunks) / float64(ps.QueriesAnalyzed)
+
+	ps.NodeTypes = make([]*NodeTypeStats, 0, len(nodeTypes))
+	for _, nt := range nodeTypes {
+		ps.NodeTypes = append(ps.NodeTypes, nt)
+	}
+	sort.Slice(ps.NodeTypes, func(i, j int) bool {
+		if ps.NodeTypes[i].Queries != ps.NodeTypes[j].Queries {
+			return ps.NodeTypes[i].Queries > ps.NodeTypes[j].Queries
+		}
+		return ps.NodeTypes[i].NodeType < ps.NodeTypes[j].NodeType
+	})
+
+	return ps
+}
+
+// samplePlan is the content of a plan file saved for an outlier query
+type samplePlan struct {
+	Rank       int               `json:"rank"`
+	Params     map[string]string `json:"params"`
+	LatencyMs  float64           `json:"latency_ms"`
+	PlanTimeMs float64           `json:"planning_time_ms"`
+	ExecTimeMs float64           `json:"execution_time_ms"`
+	IO         *IOStats          `json:"io,omitempty"`
+	Plan       json.RawMessage   `json:"plan"`
+}
+
+// resultHeap is a min-heap of results ordered by latency
+type resultHeap struct {
+	results   []*Result
+	latencyFn func(*Result) float64
+}
+
+func (h *resultHeap) Len() int { return len(h.results) }
+func (h *resultHeap) Less(i, j int) bool {
+	return h.latencyFn(h.results[i]) < h.latencyFn(h.results[j])
+}
+func (h *resultHeap) Swap(i, j int)      { h.results[i], h.results[j] = h.results[j], h.results[i] }
+func (h *resultHeap) Push(x interface{}) { h.results = append(h.results, x.(*Result)) }
+func (h *resultHeap) Pop() interface{} {
+	last := h.results[len(h.results)-1]
+	h.results = h.results[:len(h.results)-1]
+	return last
+}
+
+// planSampler retains the raw plans of the n slowest successful measured
+// queries as results come in & drops all other raw plans, so that memory
+// stays bounded however long the run.
+type planSampler struct {
+	n int
+	// slowest holds the results whose raw plans are retained
+	slowest *resultHeap
+}
+
+func newPlanSampler(n int, latencyFn func(*Result) float64) *planSampler {
+	return &planSampler{n: n, slowest: &resultHeap{latencyFn: latencyFn}}
+}
+
+// add retains the raw plan of the result if it is among the n slowest so
+// far, dropping the raw plan of the result it displaces.
+func (s *planSampler) add(res *Result) {
+	if res.RawPlan == nil {
+		return
+	}
+	if res.Err != nil || res.Job.Warmup || s.n <= 0 {
+		res.RawPlan = nil
+		return
+	}
+	h := s.slowest
+	if h.Len() < s.n {
+		heap.Push(h, res)
+		return
+	}
+	if fastest := h.results[0]; h.latencyFn(res) > h.latencyFn(fastest) {
+		fastest.RawPlan = nil
+		h.results[0] = res
+		heap.Fix(h, 0)
+		return
+	}
+	res.RawPlan = nil
+}
+
+// writeSamplePlans saves the raw plans of the n slowest successful queries
+// to the given directory, one JSON file per query named after its rank.
+func writeSamplePlans(dir string, results []*Result, n int, latencyFn func(*Result) float64) error {
+	outliers := make([]*Result, 0, len(results))
+	for _, res := range results {
+		if res.Err == nil && res.RawPlan != nil {
+			outliers = append(outliers, res)
+		}
+	}
+	sort.Slice(outliers, func(i, j int) bool { return latencyFn(outliers[i]) > latencyFn(outliers[j]) })
+	if len(outliers) > n {
+		outliers = outliers[:n]
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+
+	for i, res := range outliers {
+		b, err := json.MarshalIndent(&samplePlan{
+			Rank:       i + 1,
+			Params:     res.Job.Fields,
+			LatencyMs:  latencyFn(res),
+			PlanTimeMs: res.PlanTimeMs,
+			ExecTimeMs: res.ExecTimeMs,
+			IO:         res.IO,
+			Plan:       res.RawPlan,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan of %s: %v", res.Job, err)
+		}
+
+		name := fmt.Sprintf("%03d_%s.json", i+1, sanitizeFileName(res.Job.Hostname))
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			return fmt.Errorf("failed to write plan file %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// sanitizeFileName replaces characters that are unsafe in file names
+func sanitizeFileName(s string) string {
+	if s == "" {
+		return "query"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSummarizePlan(t *testing.T) {
+	tests := []struct {
+		name               string
+		plan               string
+		wantChunks         int
+		wantExcluded       int
+		wantChunkAppend    bool
+		wantNodeTypes      map[string]int
+		wantDecompressRows float64
+	}{
+		{
+			name: "chunk append with a compressed chunk",
+			plan: `{
+				"Node Type": "Custom Scan", "Custom Plan Provider": "ChunkAppend", "Actual Rows": 30, "Actual Loops": 1,
+				"Chunks excluded during startup": 2, "Chunks excluded during runtime": 1,
+				"Plans": [
+					{"Node Type": "Index Scan", "Relation Name": "_hyper_1_1_chunk", "Actual Rows": 10, "Actual Loops": 1},
+					{"Node Type": "Seq Scan", "Relation Name": "_hyper_1_2_chunk", "Actual Rows": 10, "Actual Loops": 1},
+					{
+						"Node Type": "Custom Scan", "Custom Plan Provider": "DecompressChunk", "Relation Name": "_hyper_1_3_chunk",
+						"Actual Rows": 5, "Actual Loops": 2,
+						"Plans": [
+							{"Node Type": "Seq Scan", "Relation Name": "compress_hyper_2_4_chunk", "Actual Rows": 1, "Actual Loops": 1}
+						]
+					}
+				]
+			}`,
+			wantChunks:      3,
+			wantExcluded:    3,
+			wantChunkAppend: true,
+			wantNodeTypes: map[string]int{
+				"Custom Scan (ChunkAppend)":     1,
+				"Custom Scan (DecompressChunk)": 1,
+				"Index Scan":                    1,
+				"Seq Scan":                      2,
+			},
+			wantDecompressRows: 10,
+		},
+		{
+			name: "chunk scanned more than once",
+			plan: `{
+				"Node Type": "Nested Loop", "Actual Rows": 1, "Actual Loops": 1,
+				"Plans": [
+					{"Node Type": "Index Scan", "Relation Name": "_hyper_1_1_chunk", "Actual Rows": 1, "Actual Loops": 1},
+					{"Node Type": "Index Only Scan", "Relation Name": "_hyper_1_1_chunk", "Actual Rows": 1, "Actual Loops": 3}
+				]
+			}`,
+			wantChunks:    1,
+			wantNodeTypes: map[string]int{"Nested Loop": 1, "Index Scan": 1, "Index Only Scan": 1},
+		},
+		{
+			name: "chunks excluded at runtime are never executed",
+			plan: `{
+				"Node Type": "Custom Scan", "Custom Plan Provider": "ChunkAppend", "Actual Rows": 1, "Actual Loops": 1,
+				"Chunks excluded during runtime": 1,
+				"Plans": [
+					{"Node Type": "Index Scan", "Relation Name": "_hyper_1_1_chunk", "Actual Rows": 1, "Actual Loops": 1},
+					{"Node Type": "Index Scan", "Relation Name": "_hyper_1_2_chunk", "Actual Rows": 0, "Actual Loops": 0}
+				]
+			}`,
+			wantChunks:      1,
+			wantExcluded:    1,
+			wantChunkAppend: true,
+			wantNodeTypes:   map[string]int{"Custom Scan (ChunkAppend)": 1, "Index Scan": 2},
+		},
+		{
+			name:          "compressed chunk scanned directly",
+			plan:          `{"Node Type": "Seq Scan", "Relation Name": "compress_hyper_2_4_chunk", "Actual Rows": 1, "Actual Loops": 1}`,
+			wantChunks:    1,
+			wantNodeTypes: map[string]int{"Seq Scan": 1},
+		},
+		{
+			name:          "plain table",
+			plan:          `{"Node Type": "Seq Scan", "Relation Name": "cpu_usage", "Actual Rows": 100, "Actual Loops": 1}`,
+			wantNodeTypes: map[string]int{"Seq Scan": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var root planNode
+			if err := json.Unmarshal([]byte(tt.plan), &root); err != nil {
+				t.Fatalf("invalid plan fixture: %v", err)
+			}
+			s := summarizePlan(&root)
+			if s.ChunksScanned != tt.wantChunks {
+				t.Errorf("chunks scanned = %d, want %d", s.ChunksScanned, tt.wantChunks)
+			}
+			if s.ChunksExcluded != tt.wantExcluded {
+				t.Errorf("chunks excluded = %d, want %d", s.ChunksExcluded, tt.wantExcluded)
+			}
+			if s.ChunkAppend != tt.wantChunkAppend {
+				t.Errorf("chunk append = %v, want %v", s.ChunkAppend, tt.wantChunkAppend)
+			}
+			if len(s.NodeTypes) != len(tt.wantNodeTypes) {
+				t.Errorf("node types = %v, want %v", s.NodeTypes, tt.wantNodeTypes)
+			}
+			for name, count := range tt.wantNodeTypes {
+				if s.NodeTypes[name] != count {
+					t.Errorf("occurrences of %s = %d, want %d", name, s.NodeTypes[name], count)
+				}
+			}
+			// Actual Rows is per loop, so the total is rows × loops
+			if got := s.NodeRows["Custom Scan (DecompressChunk)"]; got != tt.wantDecompressRows {
+				t.Errorf("DecompressChunk rows = %v, want %v", got, tt.wantDecompressRows)
+			}
+		})
+	}
+}
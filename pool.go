@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// poolOptions tune the database connection pool. Zero values leave the
+// settings of the connection string (or the pgxpool defaults) untouched.
+type poolOptions struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// validate returns an error if the options cannot be applied to a pool
+func (o poolOptions) validate() error {
+	if o.MaxConns < 0 || o.MinConns < 0 {
+		return errors.New("--max-conns & --min-conns cannot be negative")
+	}
+	if o.MaxConns > 0 && o.MinConns > o.MaxConns {
+		return errors.New("--min-conns cannot be greater than --max-conns")
+	}
+	if o.MaxConnLifetime < 0 || o.MaxConnIdleTime < 0 || o.HealthCheckPeriod < 0 {
+		return errors.New("--max-conn-lifetime, --max-conn-idle-time & --health-check-period cannot be negative")
+	}
+	return nil
+}
+
+// apply overrides the pool config with the options that are set
+func (o poolOptions) apply(config *pgxpool.Config) {
+	if o.MaxConns > 0 {
+		config.MaxConns = o.MaxConns
+	}
+	if o.MinConns > 0 {
+		config.MinConns = o.MinConns
+	}
+	if o.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = o.MaxConnLifetime
+	}
+	if o.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = o.MaxConnIdleTime
+	}
+	if o.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = o.HealthCheckPeriod
+	}
+}
+
+// hasConnParam returns true if the connection string sets the given
+// parameter, either as a URL query parameter or as a keyword/value pair.
+// Values are skipped, so a parameter named in a password doesn't count.
+func hasConnParam(connStr, key string) bool {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		u, err := url.Parse(connStr)
+		if err != nil {
+			return false
+		}
+		_, ok := u.Query()[key]
+		return ok
+	}
+
+	// keyword/value pairs are separated by whitespace, values may be
+	// quoted with ' & contain characters escaped with \
+	s := strings.TrimSpace(connStr)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return false
+		}
+		if strings.TrimSpace(s[:eq]) == key {
+			return true
+		}
+		s = strings.TrimLeftFunc(s[eq+1:], unicode.IsSpace)
+
+		quoted := strings.HasPrefix(s, "'")
+		i := 0
+		if quoted {
+			i = 1
+		}
+		for ; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if quoted && s[i] == '\'' {
+				i++
+				break
+			} else if !quoted && unicode.IsSpace(rune(s[i])) {
+				break
+			}
+		}
+		if i > len(s) {
+			i = len(s)
+		}
+		s = strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+	}
+	return false
+}
+
+// PoolStats describe how the connection pool was used over the run,
+// including warmup. Frequent empty acquires & a long acquire time mean
+// that workers spent time waiting for connections rather than on the
+// database.
+type PoolStats struct {
+	MaxConns   int32 `json:"max_conns"`
+	TotalConns int32 `json:"total_conns"`
+	// AcquireCount is the number of connections acquired from the pool, of
+	// which EmptyAcquireCount had to wait for a connection to be released
+	// or established
+	AcquireCount         int64 `json:"acquire_count"`
+	EmptyAcquireCount    int64 `json:"empty_acquire_count"`
+	CanceledAcquireCount int64 `json:"canceled_acquire_count"`
+	// AcquireMs is the total time spent acquiring connections & MeanAcquireMs
+	// is the average time per acquire
+	AcquireMs     float64 `json:"acquire_ms"`
+	MeanAcquireMs float64 `json:"mean_acquire_ms"`
+	// Undersized is true if there were fewer connections than workers
+	Undersized bool `json:"undersized"`
+}
+
+// newPoolStats returns the stats of a pool used by the given number of
+// workers.
+func newPoolStats(stat *pgxpool.Stat, workerCount int) *PoolStats {
+	s := &PoolStats{
+		MaxConns:             stat.MaxConns(),
+		TotalConns:           stat.TotalConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireMs:            durationMs(stat.AcquireDuration()),
+		Undersized:           int(stat.MaxConns()) < workerCount,
+	}
+	if s.AcquireCount > 0 {
+		s.MeanAcquireMs = s.AcquireMs / float64(s.AcquireCount)
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveProgressInterval is the refresh interval of the live progress line
+const liveProgressInterval = 500 * time.Millisecond
+
+// progressWindow is the number of most recent successful queries whose
+// latencies the running percentiles are computed from
+const progressWindow = 10000
+
+// progress tracks the results of a run as they arrive and periodically
+// renders a progress line to w. In live mode the line is redrawn in
+// place, otherwise a plain-text snapshot is printed on every tick.
+type progress struct {
+	w         io.Writer
+	live      bool
+	interval  time.Duration
+	latencyFn func(*Result) float64
+	// total is the expected number of results, 0 if unknown. If set,
+	// deadline is the time by which the run ends regardless of total.
+	total    int
+	deadline time.Time
+
+	mu        sync.Mutex
+	start     time.Time
+	completed int
+	failed    int
+	// latencies is a ring buffer of the most recent successful latencies
+	latencies []float64
+	next      int
+	// completions at the previous tick, to compute the current rate
+	lastCompleted int
+	lastTick      time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// isTerminal returns true if f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// expectedRun returns the number of jobs a run is expected to submit
+// (0 if unknown) and its max duration (0 if unbounded) given the number
+// of query params.
+func expectedRun(params int, opts loadOptions) (int, time.Duration) {
+	total := 0
+	if opts.Iterations > 0 && opts.WarmupDuration == 0 {
+		total = opts.WarmupJobs + opts.Iterations*params
+	}
+	var d time.Duration
+	if opts.Duration > 0 {
+		d = opts.WarmupDuration + opts.Duration
+	}
+	return total, d
+}
+
+// newProgress starts rendering the progress of a run to w every interval.
+// stop must be called once the run is over.
+func newProgress(w io.Writer, live bool, interval time.Duration, total int, d time.Duration, latencyFn func(*Result) float64) *progress {
+	now := time.Now()
+	p := &progress{
+		w:         w,
+		live:      live,
+		interval:  interval,
+		latencyFn: latencyFn,
+		total:     total,
+		start:     now,
+		lastTick:  now,
+		latencies: make([]float64, 0, progressWindow),
+		done:      make(chan struct{}),
+	}
+	if d > 0 {
+		p.deadline = now.Add(d)
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// add records a result of the run
+func (p *progress) add(res *Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.completed++
+	if res.Err != nil {
+		p.failed++
+		return
+	}
+	if len(p.latencies) < progressWindow {
+		p.latencies = append(p.latencies, p.latencyFn(res))
+	} else {
+		p.latencies[p.next] = p.latencyFn(res)
+	}
+	p.next = (p.next + 1) % progressWindow
+}
+
+// line returns the current progress as a single line of text
+func (p *progress) line(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	if p.total > 0 {
+		fmt.Fprintf(&b, "%d/%d (%.1f%%)", p.completed, p.total, float64(p.completed)*100/float64(p.total))
+	} else {
+		fmt.Fprintf(&b, "%d queries", p.completed)
+	}
+
+	qps := 0.0
+	if elapsed := now.Sub(p.lastTick).Seconds(); elapsed > 0 {
+		qps = float64(p.completed-p.lastCompleted) / elapsed
+	}
+	p.lastCompleted, p.lastTick = p.completed, now
+	fmt.Fprintf(&b, " | %.1f qps", qps)
+
+	if len(p.latencies) > 0 {
+		sorted := append([]float64(nil), p.latencies...)
+		sort.Float64s(sorted)
+		p50, p99 := nearestRank(sorted, 50), nearestRank(sorted, 99)
+		fmt.Fprintf(&b, " | p50 %.2f ms, p99 %.2f ms", p50, p99)
+	}
+	fmt.Fprintf(&b, " | %d failed", p.failed)
+
+	if eta, ok := p.eta(now); ok {
+		fmt.Fprintf(&b, " | ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// eta estimates the time left in the run from the average rate so far
+// and the deadline of the run, whichever ends it first.
+func (p *progress) eta(now time.Time) (time.Duration, bool) {
+	var eta time.Duration
+	ok := false
+	if p.total > 0 && p.completed > 0 {
+		rate := float64(p.completed) / now.Sub(p.start).Seconds()
+		eta = time.Duration(float64(p.total-p.completed) / rate * float64(time.Second))
+		ok = true
+	}
+	if !p.deadline.IsZero() {
+		if left := p.deadline.Sub(now); !ok || left < eta {
+			eta, ok = left, true
+		}
+	}
+	if eta < 0 {
+		eta = 0
+	}
+	return eta, ok
+}
+
+func (p *progress) render() {
+	l := p.line(time.Now())
+	if p.live {
+		// redraw the line in place, clearing what's left of the previous one
+		fmt.Fprintf(p.w, "\r\033[K%s", l)
+	} else {
+		fmt.Fprintf(p.w, "[%s] %s\n", time.Now().Format(time.RFC3339), l)
+	}
+}
+
+// stop stops rendering & clears the live progress line
+func (p *progress) stop() {
+	close(p.done)
+	p.wg.Wait()
+	if p.live {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// QueryType is a query template along with the query params it is run
+// with. A run executes either a single query type, or a mix of several
+// in proportion to their weights. Query types are identified by the name
+// of their template.
+type QueryType struct {
+	Template *QueryTemplate
+	// Header is the CSV header of the query params
+	Header []string
+	Params []*QueryParameter
+	// Weight is the share of jobs of the query type relative to the
+	// other query types of the mix
+	Weight float64
+}
+
+// QuerySpec describes a query type of a mixed workload in a scenario.
+type QuerySpec struct {
+	// Name defaults to the name of the query template
+	Name        string  `json:"name"`
+	QueryFile   string  `json:"query_file"`
+	QueryDir    string  `json:"query_dir"`
+	Query       string  `json:"query"`
+	QueryParams string  `json:"qp"`
+	HostColumn  string  `json:"host_column"`
+	Weight      float64 `json:"weight"`
+}
+
+// load reads the query template & query params of the query type. The
+// host column defaults to the given one.
+func (s *QuerySpec) load(hostColumn string) (*QueryType, error) {
+	if s.Weight <= 0 {
+		return nil, errors.New("weight must be positive")
+	}
+	if s.HostColumn != "" {
+		hostColumn = s.HostColumn
+	}
+	tmpl, err := resolveQueryTemplate(s.QueryFile, s.QueryDir, s.Query, hostColumn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load query template: %v", err)
+	}
+	if s.Name != "" {
+		// the same template may be run with different query params
+		named := *tmpl
+		named.Name = s.Name
+		tmpl = &named
+	}
+
+	header, params, err := readQueryParams(s.QueryParams, hostColumn, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryType{Template: tmpl, Header: header, Params: params, Weight: s.Weight}, nil
+}
+
+// loadQueryMix loads the query types of a mixed workload
+func loadQueryMix(specs []*QuerySpec, hostColumn string) ([]*QueryType, error) {
+	queries := make([]*QueryType, len(specs))
+	names := make(map[string]bool, len(specs))
+	for i, s := range specs {
+		q, err := s.load(hostColumn)
+		if err != nil {
+			name := s.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("invalid query type %s: %v", name, err)
+		}
+		if names[q.Template.Name] {
+			return nil, fmt.Errorf("multiple query types are named %s, name them apart", q.Template.Name)
+		}
+		names[q.Template.Name] = true
+		queries[i] = q
+	}
+	return queries, nil
+}
+
+// totalParams returns the number of query params across query types
+func totalParams(queries []*QueryType) int {
+	n := 0
+	for _, q := range queries {
+		n += len(q.Params)
+	}
+	return n
+}
+
+// queryMixer picks query types in proportion to their weights using
+// smooth weighted round-robin, which spreads every query type evenly
+// across the run, eg- weights of 7, 2 & 1 yield exactly 7, 2 & 1 jobs
+// of every 10.
+type queryMixer struct {
+	weights []float64
+	current []float64
+	total   float64
+}
+
+func newQueryMixer(queries []*QueryType) *queryMixer {
+	m := &queryMixer{weights: make([]float64, len(queries)), current: make([]float64, len(queries))}
+	for i, q := range queries {
+		m.weights[i] = q.Weight
+		m.total += q.Weight
+	}
+	return m
+}
+
+// next returns the index of the query type of the next job
+func (m *queryMixer) next() int {
+	best := 0
+	for i, w := range m.weights {
+		m.current[i] += w
+		if m.current[i] > m.current[best] {
+			best = i
+		}
+	}
+	m.current[best] -= m.total
+	return best
+}
+
+// reset starts the mix over
+func (m *queryMixer) reset() {
+	for i := range m.current {
+		m.current[i] = 0
+	}
+}
+
+// queryResults returns the results of the jobs of the given query type
+func queryResults(results []*Result, name string) []*Result {
+	res := make([]*Result, 0)
+	for _, r := range results {
+		if r.Job.Template != nil && r.Job.Template.Name == name {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// queryTypePath adds the name of a query type to a file path, eg-
+// failures.csv becomes failures_daily_rollup.csv
+func queryTypePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + sanitizeFileName(name) + ext
+}
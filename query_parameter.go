@@ -3,23 +3,55 @@ package main
 import (
 	"fmt"
 	"hash/fnv"
+	"strings"
 )
 
 type QueryParameter struct {
 	Hostname           string
 	HostID             int
 	StartTime, EndTime string
+	// Fields maps the CSV header names to the values of this record
+	Fields map[string]string
+	// columns is the CSV header, used to preserve the order of fields
+	columns []string
 }
 
-// newQueryParam takes a string slice of 3 items:
-// [hostname, start_time, end_time]
-// It returns a query param object which is also assigned a host ID based on hostname.
+// Record returns the values of the query param in CSV header order
+func (qp *QueryParameter) Record() []string {
+	rec := make([]string, len(qp.columns))
+	for i, c := range qp.columns {
+		rec[i] = qp.Fields[c]
+	}
+	return rec
+}
+
+// String returns the fields of the query param as comma-separated
+// key=value pairs in CSV header order.
+func (qp *QueryParameter) String() string {
+	pairs := make([]string, len(qp.columns))
+	for i, c := range qp.columns {
+		pairs[i] = c + "=" + qp.Fields[c]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// newQueryParam takes the CSV header and a record of the same length.
+// It returns a query param object which is also assigned a host ID based on
+// the value of the host column.
 // The ID is determined using the 32-bit FNV-1a Hashing scheme to ensure that the
 // hash value of a specific hostname is always the same.
-func newQueryParam(rec []string) (*QueryParameter, error) {
-	res := &QueryParameter{
-		Hostname: rec[0], StartTime: rec[1], EndTime: rec[2],
+func newQueryParam(header, rec []string, hostColumn string) (*QueryParameter, error) {
+	if len(rec) != len(header) {
+		return nil, fmt.Errorf("record has %d fields but header has %d", len(rec), len(header))
+	}
+
+	res := &QueryParameter{Fields: make(map[string]string, len(header)), columns: header}
+	for i, h := range header {
+		res.Fields[h] = rec[i]
 	}
+	res.Hostname = res.Fields[hostColumn]
+	res.StartTime = res.Fields["start_time"]
+	res.EndTime = res.Fields["end_time"]
 
 	h := fnv.New32a()
 	if _, err := h.Write([]byte(res.Hostname)); err != nil {
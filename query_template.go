@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// paramsDirective is the SQL comment prefix with which a query template
+// declares the CSV columns bound to its positional placeholders, eg-
+// -- params: hostname, start_time, end_time
+const paramsDirective = "-- params:"
+
+// defaultTemplateName is the name of the built-in query template
+const defaultTemplateName = "cpu_stats"
+
+// TODO: fix the seconds offset problem
+const timeSlicedCpuStatsQuery = `SELECT
+   time_bucket('1 minute', ts) AS clock, MAX(usage), MIN(usage)
+FROM cpu_usage
+WHERE
+   host = $1 AND ts BETWEEN $2 AND $3
+GROUP BY clock`
+
+var placeholderRegex = regexp.MustCompile(`\$(\d+)`)
+
+// QueryTemplate is a SQL query whose positional placeholders ($1, $2, ...)
+// are bound to the values of CSV columns, in the order of Params.
+type QueryTemplate struct {
+	Name   string
+	SQL    string
+	Params []string
+	// Positional templates bind the columns of a CSV by position if its
+	// header has exactly as many columns as Params & names none of them
+	Positional bool
+}
+
+// Args returns the query arguments for the given query parameter, ie,
+// the values of the template's columns in placeholder order.
+func (t *QueryTemplate) Args(qp *QueryParameter) []interface{} {
+	args := make([]interface{}, len(t.Params))
+	for i, p := range t.Params {
+		args[i] = qp.Fields[p]
+	}
+	return args
+}
+
+// Validate returns an error if any column required by the template is
+// missing from the given CSV header.
+func (t *QueryTemplate) Validate(header []string) error {
+	cols := make(map[string]bool, len(header))
+	for _, h := range header {
+		cols[h] = true
+	}
+	for _, p := range t.Params {
+		if !cols[p] {
+			return fmt.Errorf("query template %s requires CSV column %q which is not present in the header", t.Name, p)
+		}
+	}
+	return nil
+}
+
+// BindHeader returns the header by which the columns of a CSV are bound
+// to the template. It is the given header, unless the template is
+// positional & the header is in the legacy layout, ie, it has one column
+// per param & names none of them, in which case the columns are named
+// after the params.
+func (t *QueryTemplate) BindHeader(header []string) ([]string, error) {
+	err := t.Validate(header)
+	if err == nil || !t.Positional || len(header) != len(t.Params) {
+		return header, err
+	}
+	params := make(map[string]bool, len(t.Params))
+	for _, p := range t.Params {
+		params[p] = true
+	}
+	for _, h := range header {
+		if params[h] {
+			// some columns are named, so the others are missing
+			return header, err
+		}
+	}
+	return append([]string(nil), t.Params...), nil
+}
+
+// newDefaultQueryTemplate returns the built-in cpu stats template, which
+// binds the host, start time & end time columns, in that order.
+func newDefaultQueryTemplate(hostColumn string) *QueryTemplate {
+	return &QueryTemplate{
+		Name:       defaultTemplateName,
+		SQL:        timeSlicedCpuStatsQuery,
+		Params:     []string{hostColumn, "start_time", "end_time"},
+		Positional: true,
+	}
+}
+
+// parseQueryTemplate creates a template from raw SQL. The column names
+// bound to the placeholders are read from the params directive, and
+// every placeholder in the query must have a corresponding column.
+func parseQueryTemplate(name, sql string) (*QueryTemplate, error) {
+	t := &QueryTemplate{Name: name}
+	body := make([]string, 0)
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), paramsDirective) {
+			for _, p := range strings.Split(strings.TrimPrefix(strings.TrimSpace(line), paramsDirective), ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					t.Params = append(t.Params, p)
+				}
+			}
+			continue
+		}
+		body = append(body, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query template %s: %v", name, err)
+	}
+
+	// EXPLAIN is prepended to the query, so a trailing semicolon is dropped
+	t.SQL = strings.TrimSuffix(strings.TrimSpace(strings.Join(body, "\n")), ";")
+	if t.SQL == "" {
+		return nil, fmt.Errorf("query template %s is empty", name)
+	}
+
+	maxPlaceholder := 0
+	for _, m := range placeholderRegex.FindAllStringSubmatch(t.SQL, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n > maxPlaceholder {
+			maxPlaceholder = n
+		}
+	}
+	if maxPlaceholder != len(t.Params) {
+		return nil, fmt.Errorf(
+			"query template %s uses %d placeholders but declares %d params (use a %q comment to name them)",
+			name, maxPlaceholder, len(t.Params), paramsDirective,
+		)
+	}
+
+	return t, nil
+}
+
+// loadQueryTemplate reads a single query template from a .sql file.
+// The template is named after the file, without its extension.
+func loadQueryTemplate(path string) (*QueryTemplate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query file %s: %v", path, err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return parseQueryTemplate(name, string(b))
+}
+
+// loadQueryTemplateDir reads all .sql files in a directory and returns
+// the templates keyed by name.
+func loadQueryTemplateDir(dir string) (map[string]*QueryTemplate, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list query templates in %s: %v", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .sql files found in %s", dir)
+	}
+
+	templates := make(map[string]*QueryTemplate, len(paths))
+	for _, p := range paths {
+		t, err := loadQueryTemplate(p)
+		if err != nil {
+			return nil, err
+		}
+		templates[t.Name] = t
+	}
+	return templates, nil
+}
+
+// resolveQueryTemplate picks the template to run based on the supplied
+// query file, query directory & template name. The built-in cpu stats
+// template is used when neither a file nor a directory is given, with
+// the host bound to the given host column.
+func resolveQueryTemplate(file, dir, name, hostColumn string) (*QueryTemplate, error) {
+	if file != "" && dir != "" {
+		return nil, errors.New("only one of --query-file and --query-dir can be supplied")
+	}
+
+	if file != "" {
+		return loadQueryTemplate(file)
+	}
+
+	if dir == "" {
+		if name != "" && name != defaultTemplateName {
+			return nil, fmt.Errorf("unknown query template %s, use --query-dir to load custom templates", name)
+		}
+		return newDefaultQueryTemplate(hostColumn), nil
+	}
+
+	templates, err := loadQueryTemplateDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if len(templates) == 1 {
+			for _, t := range templates {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("multiple templates found in %s, select one using --query (available: %s)",
+			dir, strings.Join(templateNames(templates), ", "))
+	}
+
+	t, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("query template %s not found in %s (available: %s)",
+			name, dir, strings.Join(templateNames(templates), ", "))
+	}
+	return t, nil
+}
+
+func templateNames(templates map[string]*QueryTemplate) []string {
+	names := make([]string, 0, len(templates))
+	for n := range templates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
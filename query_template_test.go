@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryTemplate(t *testing.T) {
+	tests := []struct {
+		name       string
+		sql        string
+		wantSQL    string
+		wantParams []string
+		wantErr    bool
+	}{
+		{
+			name:       "params directive",
+			sql:        "-- params: device, start_time, end_time\nSELECT * FROM readings WHERE device = $1 AND ts BETWEEN $2 AND $3;\n",
+			wantSQL:    "SELECT * FROM readings WHERE device = $1 AND ts BETWEEN $2 AND $3",
+			wantParams: []string{"device", "start_time", "end_time"},
+		},
+		{
+			name:       "repeated placeholder",
+			sql:        "-- params: device\nSELECT * FROM readings WHERE device = $1 OR parent = $1",
+			wantSQL:    "SELECT * FROM readings WHERE device = $1 OR parent = $1",
+			wantParams: []string{"device"},
+		},
+		{
+			name:    "no placeholders",
+			sql:     "SELECT count(*) FROM readings",
+			wantSQL: "SELECT count(*) FROM readings",
+		},
+		{
+			name:    "missing directive",
+			sql:     "SELECT * FROM readings WHERE device = $1",
+			wantErr: true,
+		},
+		{
+			name:    "fewer params than placeholders",
+			sql:     "-- params: device\nSELECT * FROM readings WHERE device = $1 AND ts > $2",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			sql:     "-- params: device\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseQueryTemplate("test", tt.sql)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got template %+v", tmpl)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tmpl.SQL != tt.wantSQL {
+				t.Errorf("SQL = %q, want %q", tmpl.SQL, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(tmpl.Params, tt.wantParams) {
+				t.Errorf("params = %v, want %v", tmpl.Params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestBindHeader(t *testing.T) {
+	custom := &QueryTemplate{Name: "custom", Params: []string{"device", "start_time", "end_time"}}
+
+	tests := []struct {
+		name    string
+		tmpl    *QueryTemplate
+		header  []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "matching",
+			tmpl:   newDefaultQueryTemplate("hostname"),
+			header: []string{"hostname", "start_time", "end_time"},
+			want:   []string{"hostname", "start_time", "end_time"},
+		},
+		{
+			name:   "reordered",
+			tmpl:   newDefaultQueryTemplate("hostname"),
+			header: []string{"end_time", "hostname", "start_time"},
+			want:   []string{"end_time", "hostname", "start_time"},
+		},
+		{
+			name:   "extra named columns",
+			tmpl:   newDefaultQueryTemplate("hostname"),
+			header: []string{"region", "hostname", "start_time", "end_time"},
+			want:   []string{"region", "hostname", "start_time", "end_time"},
+		},
+		{
+			name:   "custom host column",
+			tmpl:   newDefaultQueryTemplate("host"),
+			header: []string{"host", "start_time", "end_time"},
+			want:   []string{"host", "start_time", "end_time"},
+		},
+		{
+			name:   "legacy positional",
+			tmpl:   newDefaultQueryTemplate("hostname"),
+			header: []string{"host", "from", "to"},
+			want:   []string{"hostname", "start_time", "end_time"},
+		},
+		{
+			name:    "extra unnamed columns",
+			tmpl:    newDefaultQueryTemplate("hostname"),
+			header:  []string{"ts_from", "host", "start_time", "end_time"},
+			wantErr: true,
+		},
+		{
+			name:    "partly named",
+			tmpl:    newDefaultQueryTemplate("hostname"),
+			header:  []string{"hostname", "start_time", "to"},
+			wantErr: true,
+		},
+		{
+			name:    "too few columns",
+			tmpl:    newDefaultQueryTemplate("hostname"),
+			header:  []string{"host", "from"},
+			wantErr: true,
+		},
+		{
+			name:    "custom templates are never positional",
+			tmpl:    custom,
+			header:  []string{"a", "b", "c"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tmpl.BindHeader(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got header %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("header = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
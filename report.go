@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Failure describes a query that could not be executed successfully.
+type Failure struct {
+	Hostname string `json:"hostname"`
+	Category string `json:"category"`
+	SQLState string `json:"sqlstate"`
+	Error    string `json:"error"`
+	Params   string `json:"params"`
+	Retries  int    `json:"retries"`
+}
+
+// Report contains the final stats of a run. It is rendered in one of
+// the supported output formats by Write.
+type Report struct {
+	// Partial is true if the run was interrupted, in which case the report
+	// only covers the queries that completed before the interrupt.
+	// CancelledQueries is the number of queries that were cancelled or
+	// never started due to an interrupt.
+	Partial          bool `json:"partial"`
+	CancelledQueries int  `json:"cancelled_queries"`
+
+	TotalQueries int `json:"total_queries"`
+	FailureCount int `json:"failure_count"`
+	TimeoutCount int `json:"timeout_count"`
+	// ElapsedSec is the wall-clock duration of the run & Throughput is
+	// the number of queries completed per second
+	ElapsedSec float64 `json:"elapsed_sec"`
+	Throughput float64 `json:"throughput_qps"`
+
+	// Latency contains the stats of the primary latency of queries, which
+	// is the total processing time reported by the server, or the client
+	// wall-clock time if queries were only timed by the client.
+	// Planning & Execution break the server processing time down into its
+	// 2 components, and Client holds the stats of client wall-clock time.
+	// In open-loop mode, ResponseTime is true & Latency is measured from
+	// the scheduled start of queries so that the time spent waiting for
+	// a free worker isn't omitted, while Service holds the stats of the
+	// primary latency from the point a worker started the query.
+	TimingMode   string            `json:"timing_mode"`
+	ResponseTime bool              `json:"response_time"`
+	Latency      *LatencyStats     `json:"latency,omitempty"`
+	Service      *LatencyStats     `json:"service,omitempty"`
+	Planning     *LatencyStats     `json:"planning,omitempty"`
+	Execution    *LatencyStats     `json:"execution,omitempty"`
+	Client       *LatencyStats     `json:"client,omitempty"`
+	Histogram    []HistogramBucket `json:"histogram,omitempty"`
+
+	Failures []Failure `json:"failures"`
+	// FailureGroups is only populated if at least 1 query failed
+	FailureGroups *FailureClassification `json:"failure_groups,omitempty"`
+	// Retries is only populated if at least 1 query was retried
+	Retries *RetryStats `json:"retries,omitempty"`
+
+	// OpenLoop is only populated if jobs were submitted at a constant rate
+	OpenLoop *OpenLoopStats `json:"open_loop,omitempty"`
+
+	// Plans is only populated if queries were timed by the server
+	Plans *PlanStats `json:"plans,omitempty"`
+	// IO is only populated if EXPLAIN reported buffer or WAL usage
+	IO *IOReport `json:"io,omitempty"`
+
+	// Queries is only populated if several query types were mixed
+	Queries []*GroupStats `json:"queries,omitempty"`
+	Hosts   []*GroupStats `json:"hosts,omitempty"`
+	Workers []*GroupStats `json:"workers,omitempty"`
+	// Utilization shows how busy every worker was
+	Utilization *UtilizationStats `json:"utilization,omitempty"`
+	// Pool contains the connection pool stats of the whole run
+	Pool *PoolStats `json:"pool,omitempty"`
+
+	// Warmup contains the stats of warmup queries, only if requested
+	Warmup *Report `json:"warmup,omitempty"`
+
+	// Comparison is only populated if the run was compared to a baseline
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
+// reportOptions control what goes into a Report
+type reportOptions struct {
+	// HistogramBounds are the upper bounds of the latency histogram buckets
+	HistogramBounds []float64
+	// PerWorker enables the per-worker breakdown in addition to per-host
+	PerWorker bool
+	// FailureExamples is the max number of example query params to
+	// include for every group of failures
+	FailureExamples int
+	// TimingMode is the mode in which query latencies were measured
+	TimingMode string
+	// ChunkThreshold is the number of chunks a query is expected to scan
+	// at most, queries exceeding it are counted in the plan stats
+	ChunkThreshold int
+	// Elapsed is the wall-clock duration of the run
+	Elapsed time.Duration
+	// Rate is the target rate of jobs in open-loop mode, 0 otherwise
+	Rate float64
+	// WorkerCount & Routing describe the worker pool that ran the jobs
+	WorkerCount int
+	Routing     string
+	// Mixed enables the per-query breakdown, for runs that mixed several
+	// query types
+	Mixed bool
+}
+
+// serviceLatency returns the function that determines the time a result
+// took from the point a worker started executing it.
+func serviceLatency(timingMode string) func(*Result) float64 {
+	if timingMode == timingClient {
+		return func(res *Result) float64 { return res.ClientTimeMs }
+	}
+	return (*Result).TotalTimeMs
+}
+
+// primaryLatency returns the function that determines the latency of a
+// result which histograms, breakdowns & comparisons are based on. It is
+// the service latency, plus the time the job waited for a worker past
+// its scheduled start in open-loop mode, to avoid coordinated omission.
+func primaryLatency(timingMode string) func(*Result) float64 {
+	service := serviceLatency(timingMode)
+	return func(res *Result) float64 {
+		if res.Job.IntendedStart.IsZero() {
+			return service(res)
+		}
+		return durationMs(res.StartTime.Sub(res.Job.IntendedStart)) + service(res)
+	}
+}
+
+// newReport computes the stats for the given results. Latency stats &
+// the histogram are only populated if at least 1 query succeeded.
+func newReport(results []*Result, opts reportOptions) (*Report, error) {
+	r := &Report{
+		TotalQueries: len(results),
+		ElapsedSec:   opts.Elapsed.Seconds(),
+		TimingMode:   opts.TimingMode,
+		ResponseTime: opts.Rate > 0,
+		Failures:     make([]Failure, 0),
+	}
+	if opts.Elapsed > 0 {
+		r.Throughput = float64(len(results)) / opts.Elapsed.Seconds()
+	}
+	latencyFn := primaryLatency(opts.TimingMode)
+	serviceFn := serviceLatency(opts.TimingMode)
+
+	// query latencies in ms
+	latencies := make([]float64, 0, len(results))
+	serviceLatencies := make([]float64, 0, len(results))
+	planLatencies := make([]float64, 0, len(results))
+	execLatencies := make([]float64, 0, len(results))
+	clientLatencies := make([]float64, 0, len(results))
+
+	for _, res := range results {
+		if res.Err != nil {
+			f := Failure{
+				Hostname: res.Job.Hostname,
+				Category: failureCategory(res.Err),
+				SQLState: sqlState(res.Err),
+				Error:    res.Err.Error(),
+				Params:   res.Job.String(),
+				Retries:  res.Retries,
+			}
+			if f.Category == failureTimeout {
+				r.TimeoutCount++
+			}
+			r.Failures = append(r.Failures, f)
+			continue
+		}
+		latencies = append(latencies, latencyFn(res))
+		serviceLatencies = append(serviceLatencies, serviceFn(res))
+		planLatencies = append(planLatencies, res.PlanTimeMs)
+		execLatencies = append(execLatencies, res.ExecTimeMs)
+		clientLatencies = append(clientLatencies, res.ClientTimeMs)
+	}
+	r.FailureCount = len(r.Failures)
+	if r.FailureCount > 0 {
+		r.FailureGroups = classifyFailures(results, opts.FailureExamples)
+	}
+
+	r.Retries = newRetryStats(results)
+	r.Plans = newPlanStats(results, opts.ChunkThreshold)
+
+	var err error
+	if opts.Rate > 0 {
+		if r.OpenLoop, err = newOpenLoopStats(results, opts.Rate); err != nil {
+			return nil, err
+		}
+	}
+	if r.IO, err = newIOReport(results); err != nil {
+		return nil, fmt.Errorf("failed to calculate I/O stats: %v", err)
+	}
+
+	if opts.Mixed {
+		r.Queries, err = newGroupStats(results, func(res *Result) string { return res.Job.Template.Name }, latencyFn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate per-query stats: %v", err)
+		}
+	}
+	r.Hosts, err = newGroupStats(results, func(res *Result) string { return res.Job.Hostname }, latencyFn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate per-host stats: %v", err)
+	}
+	if opts.PerWorker {
+		r.Workers, err = newGroupStats(results, func(res *Result) string { return strconv.Itoa(res.WorkerID) }, latencyFn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate per-worker stats: %v", err)
+		}
+	}
+
+	r.Utilization = newUtilizationStats(results, opts.WorkerCount, opts.Routing, opts.Elapsed, opts.PerWorker)
+
+	if len(latencies) == 0 {
+		return r, nil
+	}
+
+	if r.Latency, err = newLatencyStats(latencies); err != nil {
+		return nil, err
+	}
+	if r.ResponseTime {
+		if r.Service, err = newLatencyStats(serviceLatencies); err != nil {
+			return nil, fmt.Errorf("failed to calculate service time stats: %v", err)
+		}
+	}
+	if opts.TimingMode != timingClient {
+		if r.Planning, err = newLatencyStats(planLatencies); err != nil {
+			return nil, fmt.Errorf("failed to calculate planning time stats: %v", err)
+		}
+		if r.Execution, err = newLatencyStats(execLatencies); err != nil {
+			return nil, fmt.Errorf("failed to calculate execution time stats: %v", err)
+		}
+	}
+	if opts.TimingMode != timingServer {
+		if r.Client, err = newLatencyStats(clientLatencies); err != nil {
+			return nil, fmt.Errorf("failed to calculate client time stats: %v", err)
+		}
+	}
+	if r.Histogram, err = newHistogram(latencies, opts.HistogramBounds); err != nil {
+		return nil, fmt.Errorf("failed to build latency histogram: %v", err)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,897 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Supported output formats of the report
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatMarkdown = "markdown"
+)
+
+var outputFormats = []string{formatText, formatJSON, formatCSV, formatMarkdown}
+
+// histogramBarWidth is the width (in characters) of the longest bar
+// in the latency histogram chart
+const histogramBarWidth = 50
+
+// validateOutputFormat returns an error if the report cannot be
+// rendered in the given format.
+func validateOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %s, must be one of: %s", format, strings.Join(outputFormats, ", "))
+}
+
+// Write renders the report in the given format to w.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case formatText:
+		return r.writeText(w)
+	case formatJSON:
+		return r.writeJSON(w)
+	case formatCSV:
+		return r.writeCSV(w)
+	case formatMarkdown:
+		return r.writeMarkdown(w)
+	}
+	return validateOutputFormat(format)
+}
+
+// reportMetric is a single named value of the report, used by the
+// tabular output formats.
+type reportMetric struct {
+	name, value string
+}
+
+func (r *Report) metrics() []reportMetric {
+	m := []reportMetric{
+		{"partial", strconv.FormatBool(r.Partial)},
+		{"cancelled_queries", strconv.Itoa(r.CancelledQueries)},
+		{"timing_mode", r.TimingMode},
+		{"response_time", strconv.FormatBool(r.ResponseTime)},
+		{"total_queries", strconv.Itoa(r.TotalQueries)},
+		{"failure_count", strconv.Itoa(r.FailureCount)},
+		{"timeout_count", strconv.Itoa(r.TimeoutCount)},
+		{"elapsed_sec", formatFloat(r.ElapsedSec)},
+		{"throughput_qps", formatFloat(r.Throughput)},
+	}
+	if r.Latency == nil {
+		return m
+	}
+
+	m = append(m, latencyMetrics("", r.Latency)...)
+	for _, v := range []struct {
+		prefix string
+		stats  *LatencyStats
+	}{
+		{"service_", r.Service}, {"planning_", r.Planning}, {"execution_", r.Execution}, {"client_", r.Client},
+	} {
+		if v.stats != nil {
+			m = append(m, latencyMetrics(v.prefix, v.stats)...)
+		}
+	}
+	return m
+}
+
+// latencyMetrics returns all the latency stats as metrics whose names
+// start with the given prefix.
+func latencyMetrics(prefix string, l *LatencyStats) []reportMetric {
+	m := make([]reportMetric, 0, 10)
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"sum_ms", l.Sum}, {"mean_ms", l.Mean}, {"stddev_ms", l.StdDev},
+		{"min_ms", l.Min}, {"max_ms", l.Max},
+		{"p50_ms", l.P50}, {"p90_ms", l.P90}, {"p95_ms", l.P95}, {"p99_ms", l.P99}, {"p99_9_ms", l.P999},
+	} {
+		m = append(m, reportMetric{prefix + v.name, formatFloat(v.value)})
+	}
+	return m
+}
+
+// groupMetrics returns the metrics shown for every group in a breakdown
+func groupMetrics(g *GroupStats) []reportMetric {
+	m := []reportMetric{
+		{"queries", strconv.Itoa(g.Queries)},
+		{"failure_count", strconv.Itoa(g.FailureCount)},
+	}
+	l := g.Latency
+	if l == nil {
+		// all queries of the group failed
+		l = &LatencyStats{}
+	}
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"mean_ms", l.Mean}, {"p50_ms", l.P50}, {"p90_ms", l.P90},
+		{"p95_ms", l.P95}, {"p99_ms", l.P99}, {"max_ms", l.Max},
+	} {
+		m = append(m, reportMetric{v.name, formatFloat(v.value)})
+	}
+	return m
+}
+
+// failureGrouping is a titled list of failure groups in the report
+type failureGrouping struct {
+	title   string
+	section string // identifies the grouping in CSV output
+	column  string // heading of the group key column
+	groups  []*FailureGroup
+}
+
+func (r *Report) failureGroupings() []failureGrouping {
+	if r.FailureGroups == nil {
+		return nil
+	}
+	return []failureGrouping{
+		{"Failures by category", "failures_by_category", "Category", r.FailureGroups.ByCategory},
+		{"Failures by SQLSTATE", "failures_by_code", "SQLSTATE", r.FailureGroups.ByCode},
+		{"Failures by message", "failures_by_message", "Message", r.FailureGroups.ByMessage},
+		{"Failures by host", "failures_by_host", "Host", r.FailureGroups.ByHost},
+	}
+}
+
+// breakdown is a titled list of group stats in the report
+type breakdown struct {
+	title   string
+	section string // identifies the breakdown in CSV output
+	column  string // heading of the group name column
+	groups  []*GroupStats
+}
+
+// breakdowns returns the group breakdowns of the report, skipping the
+// ones that are empty.
+func (r *Report) breakdowns() []breakdown {
+	all := []breakdown{
+		{"Per-query breakdown", "query", "Query", r.Queries},
+		{"Per-host breakdown", "host", "Host", r.Hosts},
+		{"Per-worker breakdown", "worker", "Worker", r.Workers},
+	}
+	res := all[:0]
+	for _, b := range all {
+		if len(b.groups) > 0 {
+			res = append(res, b)
+		}
+	}
+	return res
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	if r.Partial {
+		fmt.Fprintf(w, "\n    *** PARTIAL REPORT: the run was interrupted, %d queries were cancelled or never started ***\n",
+			r.CancelledQueries)
+	}
+	fmt.Fprintf(w, "\n    Total number of queries run:      %d\n", r.TotalQueries)
+	fmt.Fprintf(w, "    Number of failures:               %d\n", r.FailureCount)
+	fmt.Fprintf(w, "    Number of timeouts:               %d\n", r.TimeoutCount)
+	fmt.Fprintf(w, "    Elapsed wall-clock time:          %f s\n", r.ElapsedSec)
+	fmt.Fprintf(w, "    Throughput:                       %f queries/s\n", r.Throughput)
+	if wr := r.Warmup; wr != nil {
+		fmt.Fprintf(w, "    Warmup queries (excluded above):  %d (%d failed)\n", wr.TotalQueries, wr.FailureCount)
+	}
+
+	if s := r.Latency; s != nil {
+		fmt.Fprintf(w, "    Total time across all queries:    %f ms\n", s.Sum)
+		fmt.Fprintf(w, "    Average query time:               %f ms\n", s.Mean)
+		fmt.Fprintf(w, "    Standard deviation:               %f ms\n", s.StdDev)
+		fmt.Fprintf(w, "    Minimum query time:               %f ms\n", s.Min)
+		fmt.Fprintf(w, "    Maximum query time:               %f ms\n", s.Max)
+		fmt.Fprintf(w, "    Median query time (p50):          %f ms\n", s.P50)
+		fmt.Fprintf(w, "    p90 query time:                   %f ms\n", s.P90)
+		fmt.Fprintf(w, "    p95 query time:                   %f ms\n", s.P95)
+		fmt.Fprintf(w, "    p99 query time:                   %f ms\n", s.P99)
+		fmt.Fprintf(w, "    p99.9 query time:                 %f ms\n", s.P999)
+		if r.ResponseTime {
+			fmt.Fprintln(w, "    Query times are response times measured from the scheduled start of queries,")
+			fmt.Fprintln(w, "    including the time spent waiting for a free worker.")
+		}
+	}
+	fmt.Fprintln(w)
+
+	if phases := r.phases(); len(phases) > 0 {
+		fmt.Fprintln(w, "    Latency breakdown:")
+		if r.Warmup != nil && r.Warmup.Latency != nil {
+			phases = append(phases, phase{"Warmup", r.Warmup.Latency})
+		}
+		writePhaseTable(w, phases)
+	}
+
+	writeHistogramChart(w, r.Histogram)
+
+	if r.Retries != nil {
+		writeRetryStats(w, r.Retries)
+	}
+	if r.OpenLoop != nil {
+		writeOpenLoopStats(w, r.OpenLoop)
+	}
+
+	if r.Plans != nil {
+		writePlanStats(w, r.Plans)
+	}
+	if r.IO != nil {
+		writeIOReport(w, r.IO)
+	}
+
+	for _, b := range r.breakdowns() {
+		fmt.Fprintf(w, "    %s (sorted by p99):\n", b.title)
+		writeGroupTable(w, b.column, b.groups)
+	}
+	if r.Utilization != nil {
+		writeUtilization(w, r.Utilization)
+	}
+	if r.Pool != nil {
+		writePoolStats(w, r.Pool)
+	}
+
+	for _, fg := range r.failureGroupings() {
+		fmt.Fprintf(w, "    %s:\n", fg.title)
+		for _, g := range fg.groups {
+			fmt.Fprintf(w, "      %6d  %s\n", g.Count, g.Key)
+			for _, e := range g.Examples {
+				fmt.Fprintf(w, "              e.g. %s\n", e)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if r.TimeoutCount > 0 {
+		fmt.Fprintln(w, "    Timed out queries:")
+		for _, f := range r.Failures {
+			if f.Category == failureTimeout {
+				fmt.Fprintf(w, "      %s\n", f.Params)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if r.Comparison != nil {
+		writeComparisonText(w, r.Comparison)
+	}
+
+	return nil
+}
+
+// phase is a named component of the query processing time
+type phase struct {
+	name  string
+	stats *LatencyStats
+}
+
+// phases returns the components of query latency that were measured,
+// so that server & client latency can be compared side by side. The
+// response time comes last in open-loop mode.
+func (r *Report) phases() []phase {
+	res := make([]phase, 0, 5)
+	if r.Planning != nil {
+		serverTotal := r.Latency
+		if r.Service != nil {
+			serverTotal = r.Service
+		}
+		res = append(res,
+			phase{"Planning", r.Planning},
+			phase{"Execution", r.Execution},
+			phase{"Server total", serverTotal},
+		)
+	}
+	if r.Client != nil {
+		res = append(res, phase{"Client", r.Client})
+	}
+	if r.ResponseTime && len(res) > 0 {
+		res = append(res, phase{"Response", r.Latency})
+	}
+	return res
+}
+
+// writePhaseTable prints the latency stats of each phase as an aligned table
+func writePhaseTable(w io.Writer, phases []phase) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    \tMean (ms)\tStdDev (ms)\tMin (ms)\tp50 (ms)\tp90 (ms)\tp99 (ms)\tMax (ms)\t")
+	for _, p := range phases {
+		s := p.stats
+		fmt.Fprintf(tw, "    %s\t%f\t%f\t%f\t%f\t%f\t%f\t%f\t\n",
+			p.name, s.Mean, s.StdDev, s.Min, s.P50, s.P90, s.P99, s.Max)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// planMetrics returns the aggregate plan stats as metrics
+func planMetrics(ps *PlanStats) []reportMetric {
+	return []reportMetric{
+		{"queries_analyzed", strconv.Itoa(ps.QueriesAnalyzed)},
+		{"chunk_threshold", strconv.Itoa(ps.ChunkThreshold)},
+		{"queries_over_chunk_threshold", strconv.Itoa(ps.QueriesOverChunkThreshold)},
+		{"min_chunks_scanned", strconv.Itoa(ps.MinChunksScanned)},
+		{"mean_chunks_scanned", formatFloat(ps.MeanChunksScanned)},
+		{"max_chunks_scanned", strconv.Itoa(ps.MaxChunksScanned)},
+		{"chunk_append_queries", strconv.Itoa(ps.ChunkAppendQueries)},
+		{"exclusion_queries", strconv.Itoa(ps.ExclusionQueries)},
+		{"chunks_excluded", strconv.Itoa(ps.ChunksExcluded)},
+	}
+}
+
+// nodeTypeMetrics returns the aggregate stats of a plan node type as metrics
+func nodeTypeMetrics(nt *NodeTypeStats) []reportMetric {
+	return []reportMetric{
+		{"queries", strconv.Itoa(nt.Queries)},
+		{"occurrences", strconv.Itoa(nt.Occurrences)},
+		{"actual_rows", strconv.FormatFloat(nt.ActualRows, 'f', -1, 64)},
+		{"actual_loops", strconv.FormatFloat(nt.ActualLoops, 'f', -1, 64)},
+	}
+}
+
+// writePlanStats prints the aggregate plan stats followed by a table of
+// the node types found in the plans.
+func writePlanStats(w io.Writer, ps *PlanStats) {
+	fmt.Fprintf(w, "    Query plans (%d queries analyzed):\n", ps.QueriesAnalyzed)
+	for _, l := range []struct{ label, value string }{
+		{fmt.Sprintf("Queries scanning more than %d chunk(s):", ps.ChunkThreshold),
+			fmt.Sprintf("%d of %d", ps.QueriesOverChunkThreshold, ps.QueriesAnalyzed)},
+		{"Chunks scanned per query:",
+			fmt.Sprintf("min %d, mean %.2f, max %d", ps.MinChunksScanned, ps.MeanChunksScanned, ps.MaxChunksScanned)},
+		{"Queries using ChunkAppend:",
+			fmt.Sprintf("%d of %d", ps.ChunkAppendQueries, ps.QueriesAnalyzed)},
+		{"Queries with chunk exclusion:",
+			fmt.Sprintf("%d of %d (%d chunks excluded)", ps.ExclusionQueries, ps.QueriesAnalyzed, ps.ChunksExcluded)},
+	} {
+		fmt.Fprintf(w, "      %-40s %s\n", l.label, l.value)
+	}
+	if len(ps.Settings) > 0 {
+		fmt.Fprintf(w, "      %-40s %s\n", "Non-default settings:", formatSettings(ps.Settings))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    Node type\tQueries\tOccurrences\tActual rows\tActual loops\t")
+	for _, nt := range ps.NodeTypes {
+		fmt.Fprintf(tw, "    %s\t", nt.NodeType)
+		for _, m := range nodeTypeMetrics(nt) {
+			fmt.Fprintf(tw, "%s\t", m.value)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// retryMetrics returns the retry stats as metrics
+func retryMetrics(rs *RetryStats) []reportMetric {
+	return []reportMetric{
+		{"retried_queries", strconv.Itoa(rs.RetriedQueries)},
+		{"total_retries", strconv.Itoa(rs.TotalRetries)},
+		{"succeeded_after_retry", strconv.Itoa(rs.SucceededAfterRetry)},
+		{"failed_after_retry", strconv.Itoa(rs.FailedAfterRetry)},
+	}
+}
+
+// writeRetryStats prints how many queries were retried & their outcome,
+// followed by the number of queries per retry count.
+func writeRetryStats(w io.Writer, rs *RetryStats) {
+	fmt.Fprintln(w, "    Retries:")
+	fmt.Fprintf(w, "      %-40s %d (%d retries in total)\n", "Queries retried:", rs.RetriedQueries, rs.TotalRetries)
+	fmt.Fprintf(w, "      %-40s %d\n", "Succeeded only after retrying:", rs.SucceededAfterRetry)
+	fmt.Fprintf(w, "      %-40s %d\n", "Failed despite retrying:", rs.FailedAfterRetry)
+	for _, c := range rs.Distribution {
+		fmt.Fprintf(w, "      %-40s %d\n", fmt.Sprintf("Queries retried %d time(s):", c.Retries), c.Queries)
+	}
+	fmt.Fprintln(w)
+}
+
+// utilizationMetrics returns the aggregate worker utilization as metrics
+func utilizationMetrics(u *UtilizationStats) []reportMetric {
+	return []reportMetric{
+		{"routing", u.Routing},
+		{"mean", formatFloat(u.Mean)},
+		{"min", formatFloat(u.Min)},
+		{"max", formatFloat(u.Max)},
+	}
+}
+
+// workerUtilizationMetrics returns the utilization of a worker as metrics
+func workerUtilizationMetrics(wu *WorkerUtilization) []reportMetric {
+	return []reportMetric{
+		{"queries", strconv.Itoa(wu.Queries)},
+		{"busy_sec", formatFloat(wu.BusySec)},
+		{"utilization", formatFloat(wu.Utilization)},
+	}
+}
+
+// writeUtilization prints the spread of worker utilization followed by
+// a table of the utilization of every worker, if available.
+func writeUtilization(w io.Writer, u *UtilizationStats) {
+	fmt.Fprintf(w, "    Worker utilization (routing: %s):\n", u.Routing)
+	fmt.Fprintf(w, "      %-40s min %.2f%%, mean %.2f%%, max %.2f%%\n\n", "Utilization:", u.Min*100, u.Mean*100, u.Max*100)
+	if len(u.Workers) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    Worker\tQueries\tBusy (s)\tUtilization\t")
+	for _, wu := range u.Workers {
+		fmt.Fprintf(tw, "    %d\t%d\t%f\t%.2f%%\t\n", wu.Worker, wu.Queries, wu.BusySec, wu.Utilization*100)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// poolMetrics returns the connection pool stats as metrics
+func poolMetrics(p *PoolStats) []reportMetric {
+	return []reportMetric{
+		{"max_conns", strconv.Itoa(int(p.MaxConns))},
+		{"total_conns", strconv.Itoa(int(p.TotalConns))},
+		{"acquire_count", strconv.FormatInt(p.AcquireCount, 10)},
+		{"empty_acquire_count", strconv.FormatInt(p.EmptyAcquireCount, 10)},
+		{"canceled_acquire_count", strconv.FormatInt(p.CanceledAcquireCount, 10)},
+		{"acquire_ms", formatFloat(p.AcquireMs)},
+		{"mean_acquire_ms", formatFloat(p.MeanAcquireMs)},
+		{"undersized", strconv.FormatBool(p.Undersized)},
+	}
+}
+
+// writePoolStats prints how the connection pool was used
+func writePoolStats(w io.Writer, p *PoolStats) {
+	fmt.Fprintf(w, "    Connection pool (max %d connections):\n", p.MaxConns)
+	fmt.Fprintf(w, "      %-40s %d\n", "Connections acquired:", p.AcquireCount)
+	fmt.Fprintf(w, "      %-40s %d of %d\n", "Acquires that waited for a connection:", p.EmptyAcquireCount, p.AcquireCount)
+	fmt.Fprintf(w, "      %-40s %d\n", "Acquires cancelled:", p.CanceledAcquireCount)
+	fmt.Fprintf(w, "      %-40s %f ms (mean %f ms)\n", "Time spent acquiring connections:", p.AcquireMs, p.MeanAcquireMs)
+	if p.Undersized {
+		fmt.Fprintf(w, "      WARNING: there are fewer connections than workers, consider raising --max-conns\n")
+	}
+	fmt.Fprintln(w)
+}
+
+// openLoopMetrics returns the open-loop stats as metrics
+func openLoopMetrics(ol *OpenLoopStats) []reportMetric {
+	m := []reportMetric{
+		{"target_rate_qps", formatFloat(ol.TargetRate)},
+		{"achieved_rate_qps", formatFloat(ol.AchievedRate)},
+		{"fell_behind", strconv.FormatBool(ol.FellBehind)},
+	}
+	return append(m, latencyMetrics("start_delay_", ol.StartDelay)...)
+}
+
+// writeOpenLoopStats prints how well the target rate was sustained along
+// with the latency of queries measured from their scheduled start.
+func writeOpenLoopStats(w io.Writer, ol *OpenLoopStats) {
+	fmt.Fprintf(w, "    Open-loop load (target rate %.2f queries/s):\n", ol.TargetRate)
+	fmt.Fprintf(w, "      %-40s %.2f queries/s\n", "Achieved rate:", ol.AchievedRate)
+	if ol.FellBehind {
+		fmt.Fprintf(w, "      WARNING: the worker pool could not keep up with the target rate, consider adding workers\n")
+	}
+	fmt.Fprintln(w)
+
+	writePhaseTable(w, []phase{{"Start delay", ol.StartDelay}})
+}
+
+// formatSettings returns the settings as sorted, comma-separated
+// key=value pairs
+func formatSettings(settings map[string]string) string {
+	pairs := make([]string, 0, len(settings))
+	for k, v := range settings {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// ioMetrics returns the aggregate I/O stats as metrics
+func ioMetrics(io *IOReport) []reportMetric {
+	return []reportMetric{
+		{"queries", strconv.Itoa(io.Queries)},
+		{"cold_queries", strconv.Itoa(io.ColdQueries)},
+		{"hit_ratio", formatFloat(io.HitRatio)},
+	}
+}
+
+// ioCounterMetrics returns the stats of an I/O counter as metrics
+func ioCounterMetrics(c *IOCounterStats) []reportMetric {
+	return []reportMetric{
+		{"total", formatFloat(c.Total)},
+		{"mean", formatFloat(c.Mean)},
+		{"p50", formatFloat(c.P50)},
+		{"p95", formatFloat(c.P95)},
+		{"max", formatFloat(c.Max)},
+	}
+}
+
+// writeIOReport prints the aggregate I/O stats followed by a table of
+// the per-query distribution of every I/O counter.
+func writeIOReport(w io.Writer, io *IOReport) {
+	fmt.Fprintf(w, "    I/O (%d queries analyzed):\n", io.Queries)
+	fmt.Fprintf(w, "      %-40s %d of %d\n", "Queries reading blocks from disk:", io.ColdQueries, io.Queries)
+	fmt.Fprintf(w, "      %-40s %.2f%%\n\n", "Shared buffer hit ratio:", io.HitRatio*100)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "    Counter\tTotal\tMean/query\tp50\tp95\tMax\t")
+	for _, c := range io.Counters {
+		fmt.Fprintf(tw, "    %s\t", c.Name)
+		for _, m := range ioCounterMetrics(c) {
+			fmt.Fprintf(tw, "%s\t", m.value)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// writeGroupTable prints the stats of each group as an aligned table
+func writeGroupTable(w io.Writer, name string, groups []*GroupStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "    %s\tQueries\tFailures\tMean (ms)\tp50 (ms)\tp90 (ms)\tp95 (ms)\tp99 (ms)\tMax (ms)\t\n", name)
+	for _, g := range groups {
+		fmt.Fprintf(tw, "    %s\t", g.Name)
+		for _, m := range groupMetrics(g) {
+			fmt.Fprintf(tw, "%s\t", m.value)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+// writeHistogramChart renders the latency histogram as an ASCII bar chart.
+// Empty buckets before the first and after the last non-empty bucket
+// are left out to keep the chart compact.
+func writeHistogramChart(w io.Writer, buckets []HistogramBucket) {
+	first, last, maxCount := -1, -1, 0
+	for i, b := range buckets {
+		if b.Count == 0 {
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		last = i
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	if first == -1 {
+		return
+	}
+
+	fmt.Fprintln(w, "    Latency histogram (ms):")
+	for _, b := range buckets[first : last+1] {
+		bar := strings.Repeat("#", b.Count*histogramBarWidth/maxCount)
+		if bar == "" && b.Count > 0 {
+			// make sure non-empty buckets are always visible
+			bar = "#"
+		}
+		fmt.Fprintf(w, "    %15s | %-*s %d\n", b.Label(), histogramBarWidth, bar, b.Count)
+	}
+	fmt.Fprintln(w)
+}
+
+func (r *Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// writeCSV writes the report as rows of (section, key, metric, value) so
+// that all parts of the report fit in a single table. The key identifies
+// the item of a section that the metric belongs to, eg- a host.
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{{"section", "key", "metric", "value"}}
+
+	for _, m := range r.metrics() {
+		rows = append(rows, []string{"summary", "", m.name, m.value})
+	}
+	if r.Warmup != nil {
+		for _, m := range r.Warmup.metrics() {
+			rows = append(rows, []string{"warmup", "", m.name, m.value})
+		}
+	}
+	for _, b := range r.Histogram {
+		rows = append(rows, []string{"histogram", b.Label(), "count", strconv.Itoa(b.Count)})
+	}
+	for _, f := range r.Failures {
+		rows = append(rows, []string{"failure", f.Hostname, "category", f.Category})
+		rows = append(rows, []string{"failure", f.Hostname, "sqlstate", f.SQLState})
+		rows = append(rows, []string{"failure", f.Hostname, "error", f.Error})
+		rows = append(rows, []string{"failure", f.Hostname, "params", f.Params})
+		rows = append(rows, []string{"failure", f.Hostname, "retries", strconv.Itoa(f.Retries)})
+	}
+	for _, fg := range r.failureGroupings() {
+		for _, g := range fg.groups {
+			rows = append(rows, []string{fg.section, g.Key, "count", strconv.Itoa(g.Count)})
+			for _, e := range g.Examples {
+				rows = append(rows, []string{fg.section, g.Key, "example", e})
+			}
+		}
+	}
+	if r.Retries != nil {
+		for _, m := range retryMetrics(r.Retries) {
+			rows = append(rows, []string{"retries", "", m.name, m.value})
+		}
+		for _, c := range r.Retries.Distribution {
+			rows = append(rows, []string{"retry_distribution", strconv.Itoa(c.Retries), "queries", strconv.Itoa(c.Queries)})
+		}
+	}
+	if r.OpenLoop != nil {
+		for _, m := range openLoopMetrics(r.OpenLoop) {
+			rows = append(rows, []string{"open_loop", "", m.name, m.value})
+		}
+	}
+	if r.Plans != nil {
+		for _, m := range planMetrics(r.Plans) {
+			rows = append(rows, []string{"plan", "", m.name, m.value})
+		}
+		for _, nt := range r.Plans.NodeTypes {
+			for _, m := range nodeTypeMetrics(nt) {
+				rows = append(rows, []string{"plan_node", nt.NodeType, m.name, m.value})
+			}
+		}
+		if len(r.Plans.Settings) > 0 {
+			rows = append(rows, []string{"plan", "", "settings", formatSettings(r.Plans.Settings)})
+		}
+	}
+	if r.IO != nil {
+		for _, m := range ioMetrics(r.IO) {
+			rows = append(rows, []string{"io", "", m.name, m.value})
+		}
+		for _, c := range r.IO.Counters {
+			for _, m := range ioCounterMetrics(c) {
+				rows = append(rows, []string{"io_counter", c.Name, m.name, m.value})
+			}
+		}
+	}
+	for _, b := range r.breakdowns() {
+		for _, g := range b.groups {
+			for _, m := range groupMetrics(g) {
+				rows = append(rows, []string{b.section, g.Name, m.name, m.value})
+			}
+		}
+	}
+	if r.Utilization != nil {
+		for _, m := range utilizationMetrics(r.Utilization) {
+			rows = append(rows, []string{"utilization", "", m.name, m.value})
+		}
+		for _, wu := range r.Utilization.Workers {
+			for _, m := range workerUtilizationMetrics(wu) {
+				rows = append(rows, []string{"worker_utilization", strconv.Itoa(wu.Worker), m.name, m.value})
+			}
+		}
+	}
+	if r.Pool != nil {
+		for _, m := range poolMetrics(r.Pool) {
+			rows = append(rows, []string{"pool", "", m.name, m.value})
+		}
+	}
+
+	if r.Comparison != nil {
+		rows = append(rows, comparisonRows(r.Comparison)...)
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write CSV report: %v", err)
+	}
+	return nil
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	if r.Partial {
+		fmt.Fprintf(w, "> **Partial report:** the run was interrupted, %d queries were cancelled or never started.\n\n",
+			r.CancelledQueries)
+	}
+	fmt.Fprintln(w, "## Summary")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Metric | Value |")
+	fmt.Fprintln(w, "| --- | ---: |")
+	for _, m := range r.metrics() {
+		fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+	}
+
+	if r.Warmup != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Warmup")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range r.Warmup.metrics() {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+	}
+
+	if len(r.Histogram) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Latency histogram")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Bucket (ms) | Count |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, b := range r.Histogram {
+			fmt.Fprintf(w, "| %s | %d |\n", b.Label(), b.Count)
+		}
+	}
+
+	if r.Retries != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Retries")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range retryMetrics(r.Retries) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Retries | Queries |")
+		fmt.Fprintln(w, "| ---: | ---: |")
+		for _, c := range r.Retries.Distribution {
+			fmt.Fprintf(w, "| %d | %d |\n", c.Retries, c.Queries)
+		}
+	}
+
+	if r.OpenLoop != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Open-loop load")
+		fmt.Fprintln(w)
+		if r.OpenLoop.FellBehind {
+			fmt.Fprintln(w, "> **Warning:** the worker pool could not keep up with the target rate.")
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range openLoopMetrics(r.OpenLoop) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+	}
+
+	if r.Plans != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Query plans")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range planMetrics(r.Plans) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+		if len(r.Plans.Settings) > 0 {
+			fmt.Fprintf(w, "| settings | %s |\n", escapeMarkdown(formatSettings(r.Plans.Settings)))
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Node type | Queries | Occurrences | Actual rows | Actual loops |")
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: |")
+		for _, nt := range r.Plans.NodeTypes {
+			fmt.Fprintf(w, "| %s |", escapeMarkdown(nt.NodeType))
+			for _, m := range nodeTypeMetrics(nt) {
+				fmt.Fprintf(w, " %s |", m.value)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if r.IO != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## I/O")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range ioMetrics(r.IO) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Counter | Total | Mean/query | p50 | p95 | Max |")
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: |")
+		for _, c := range r.IO.Counters {
+			fmt.Fprintf(w, "| %s |", c.Name)
+			for _, m := range ioCounterMetrics(c) {
+				fmt.Fprintf(w, " %s |", m.value)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	for _, b := range r.breakdowns() {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %s\n", b.title)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "| %s | Queries | Failures | Mean (ms) | p50 (ms) | p90 (ms) | p95 (ms) | p99 (ms) | Max (ms) |\n", b.column)
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: |")
+		for _, g := range b.groups {
+			fmt.Fprintf(w, "| %s |", escapeMarkdown(g.Name))
+			for _, m := range groupMetrics(g) {
+				fmt.Fprintf(w, " %s |", m.value)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if r.Utilization != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Worker utilization")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range utilizationMetrics(r.Utilization) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+		if len(r.Utilization.Workers) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| Worker | Queries | Busy (s) | Utilization |")
+			fmt.Fprintln(w, "| ---: | ---: | ---: | ---: |")
+			for _, wu := range r.Utilization.Workers {
+				fmt.Fprintf(w, "| %d |", wu.Worker)
+				for _, m := range workerUtilizationMetrics(wu) {
+					fmt.Fprintf(w, " %s |", m.value)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+
+	if r.Pool != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Connection pool")
+		fmt.Fprintln(w)
+		if r.Pool.Undersized {
+			fmt.Fprintln(w, "> **Warning:** there are fewer connections than workers.")
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "| Metric | Value |")
+		fmt.Fprintln(w, "| --- | ---: |")
+		for _, m := range poolMetrics(r.Pool) {
+			fmt.Fprintf(w, "| %s | %s |\n", m.name, m.value)
+		}
+	}
+
+	for _, fg := range r.failureGroupings() {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %s\n", fg.title)
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "| %s | Count | Examples |\n", fg.column)
+		fmt.Fprintln(w, "| --- | ---: | --- |")
+		for _, g := range fg.groups {
+			examples := make([]string, len(g.Examples))
+			for i, e := range g.Examples {
+				examples[i] = escapeMarkdown(e)
+			}
+			fmt.Fprintf(w, "| %s | %d | %s |\n", escapeMarkdown(g.Key), g.Count, strings.Join(examples, "<br>"))
+		}
+	}
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Failures")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Host | Category | SQLSTATE | Error | Params | Retries |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | ---: |")
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %d |\n",
+				escapeMarkdown(f.Hostname), f.Category, f.SQLState, escapeMarkdown(f.Error), escapeMarkdown(f.Params), f.Retries)
+		}
+	}
+
+	if r.Comparison != nil {
+		fmt.Fprintln(w)
+		writeComparisonMarkdown(w, r.Comparison)
+	}
+
+	return nil
+}
+
+// escapeMarkdown prevents a value from breaking the layout of a table cell
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
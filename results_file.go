@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultRecord is a flattened Result as written to the results file
+type resultRecord struct {
+	// Query is the name of the query template
+	Query    string `json:"query"`
+	Hostname string `json:"hostname"`
+	HostID   int    `json:"host_id"`
+	// StartTime & EndTime are the time range of the query param
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	WorkerID  int    `json:"worker_id"`
+	Warmup    bool   `json:"warmup"`
+	// ScheduledAt is only set in open-loop mode. DispatchedAt is when the
+	// pool routed the job to a worker, StartedAt when the worker started
+	// executing it & CompletedAt when the worker finished.
+	ScheduledAt  string  `json:"scheduled_at,omitempty"`
+	DispatchedAt string  `json:"dispatched_at"`
+	StartedAt    string  `json:"started_at"`
+	CompletedAt  string  `json:"completed_at"`
+	PlanTimeMs   float64 `json:"planning_ms"`
+	ExecTimeMs   float64 `json:"execution_ms"`
+	ClientTimeMs float64 `json:"client_ms"`
+	Retries      int     `json:"retries"`
+	SQLState     string  `json:"sqlstate,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	// Params contains all fields of the query param
+	Params map[string]string `json:"params"`
+}
+
+// resultColumns is the CSV header of the results file. The params are
+// left out as they are already present in dedicated columns or can be
+// joined back from the query params CSV.
+var resultColumns = []string{
+	"query", "hostname", "host_id", "start_time", "end_time", "worker_id", "warmup",
+	"scheduled_at", "dispatched_at", "started_at", "completed_at",
+	"planning_ms", "execution_ms", "client_ms", "retries", "sqlstate", "error",
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func newResultRecord(res *Result) *resultRecord {
+	rec := &resultRecord{
+		Query:        res.Job.Template.Name,
+		Hostname:     res.Job.Hostname,
+		HostID:       res.Job.HostID,
+		StartTime:    res.Job.StartTime,
+		EndTime:      res.Job.EndTime,
+		WorkerID:     res.WorkerID,
+		Warmup:       res.Job.Warmup,
+		ScheduledAt:  formatTime(res.Job.IntendedStart),
+		DispatchedAt: formatTime(res.Job.DispatchedAt),
+		StartedAt:    formatTime(res.StartTime),
+		CompletedAt:  formatTime(res.EndTime),
+		PlanTimeMs:   res.PlanTimeMs,
+		ExecTimeMs:   res.ExecTimeMs,
+		ClientTimeMs: res.ClientTimeMs,
+		Retries:      res.Retries,
+		Params:       res.Job.Fields,
+	}
+	if res.Err != nil {
+		rec.SQLState = sqlState(res.Err)
+		rec.Error = res.Err.Error()
+	}
+	return rec
+}
+
+// csv returns the record as values in the order of resultColumns
+func (r *resultRecord) csv() []string {
+	return []string{
+		r.Query, r.Hostname, strconv.Itoa(r.HostID), r.StartTime, r.EndTime,
+		strconv.Itoa(r.WorkerID), strconv.FormatBool(r.Warmup),
+		r.ScheduledAt, r.DispatchedAt, r.StartedAt, r.CompletedAt,
+		formatFloat(r.PlanTimeMs), formatFloat(r.ExecTimeMs), formatFloat(r.ClientTimeMs),
+		strconv.Itoa(r.Retries), r.SQLState, r.Error,
+	}
+}
+
+// result converts the record back into a Result
+func (r *resultRecord) result() (*Result, error) {
+	res := &Result{
+		Job: &Job{
+			QueryParameter: &QueryParameter{
+				Hostname:  r.Hostname,
+				HostID:    r.HostID,
+				StartTime: r.StartTime,
+				EndTime:   r.EndTime,
+				Fields:    r.Params,
+			},
+			Template: &QueryTemplate{Name: r.Query},
+			Warmup:   r.Warmup,
+		},
+		WorkerID:     r.WorkerID,
+		PlanTimeMs:   r.PlanTimeMs,
+		ExecTimeMs:   r.ExecTimeMs,
+		ClientTimeMs: r.ClientTimeMs,
+		Retries:      r.Retries,
+	}
+	if r.Error != "" {
+		res.Err = errors.New(r.Error)
+	}
+
+	for _, t := range []struct {
+		value string
+		dst   *time.Time
+	}{
+		{r.ScheduledAt, &res.Job.IntendedStart}, {r.DispatchedAt, &res.Job.DispatchedAt},
+		{r.StartedAt, &res.StartTime}, {r.CompletedAt, &res.EndTime},
+	} {
+		if t.value == "" {
+			continue
+		}
+		var err error
+		if *t.dst, err = time.Parse(time.RFC3339Nano, t.value); err != nil {
+			return nil, fmt.Errorf("invalid time %s: %v", t.value, err)
+		}
+	}
+	return res, nil
+}
+
+// parseResultRecord reads a CSV record of the results file, whose header
+// maps column names to their index in the record.
+func parseResultRecord(header map[string]int, rec []string) (*resultRecord, error) {
+	get := func(col string) string {
+		if i, ok := header[col]; ok && i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+
+	r := &resultRecord{
+		Query:        get("query"),
+		Hostname:     get("hostname"),
+		StartTime:    get("start_time"),
+		EndTime:      get("end_time"),
+		ScheduledAt:  get("scheduled_at"),
+		DispatchedAt: get("dispatched_at"),
+		StartedAt:    get("started_at"),
+		CompletedAt:  get("completed_at"),
+		SQLState:     get("sqlstate"),
+		Error:        get("error"),
+	}
+
+	var err error
+	for _, v := range []struct {
+		col string
+		dst *int
+	}{
+		{"host_id", &r.HostID}, {"worker_id", &r.WorkerID}, {"retries", &r.Retries},
+	} {
+		if *v.dst, err = strconv.Atoi(get(v.col)); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", v.col, err)
+		}
+	}
+	for _, v := range []struct {
+		col string
+		dst *float64
+	}{
+		{"planning_ms", &r.PlanTimeMs}, {"execution_ms", &r.ExecTimeMs}, {"client_ms", &r.ClientTimeMs},
+	} {
+		if *v.dst, err = strconv.ParseFloat(get(v.col), 64); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", v.col, err)
+		}
+	}
+	if r.Warmup, err = strconv.ParseBool(get("warmup")); err != nil {
+		return nil, fmt.Errorf("invalid warmup: %v", err)
+	}
+	return r, nil
+}
+
+// readResultsFile reads the results of a previous run from a file written
+// by writeResultsFile.
+func readResultsFile(path string) ([]*Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	records := make([]*resultRecord, 0)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(bufio.NewReader(f)).Decode(&records); err != nil {
+			return nil, fmt.Errorf("failed to read results from %s: %v", path, err)
+		}
+	case ".jsonl":
+		dec := json.NewDecoder(bufio.NewReader(f))
+		for {
+			var rec resultRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read result %d from %s: %v", len(records)+1, path, err)
+			}
+			records = append(records, &rec)
+		}
+	default:
+		r := csv.NewReader(f)
+		cols, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header of %s: %v", path, err)
+		}
+		header := make(map[string]int, len(cols))
+		for i, c := range cols {
+			header[c] = i
+		}
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			parsed, err := parseResultRecord(header, rec)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse result %d from %s: %v", len(records)+1, path, err)
+			}
+			records = append(records, parsed)
+		}
+	}
+
+	results := make([]*Result, len(records))
+	for i, rec := range records {
+		if results[i], err = rec.result(); err != nil {
+			return nil, fmt.Errorf("failed to parse result %d from %s: %v", i+1, path, err)
+		}
+	}
+	return results, nil
+}
+
+// writeResultsFile writes every result to a file, one JSON object per line
+// if the file has a .jsonl extension, as a JSON array if it has a .json
+// extension (like --timeline) & as CSV otherwise.
+func writeResultsFile(path string, results []*Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".jsonl" || ext == ".json" {
+		bw := bufio.NewWriter(f)
+		enc := json.NewEncoder(bw)
+		array := ext == ".json"
+		if array {
+			bw.WriteString("[\n")
+		}
+		for i, res := range results {
+			if array && i > 0 {
+				bw.WriteString(",")
+			}
+			if err := enc.Encode(newResultRecord(res)); err != nil {
+				return fmt.Errorf("failed to write result to %s: %v", path, err)
+			}
+		}
+		if array {
+			bw.WriteString("]\n")
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write(resultColumns); err != nil {
+		return fmt.Errorf("failed to write header to %s: %v", path, err)
+	}
+	for _, res := range results {
+		if err := w.Write(newResultRecord(res).csv()); err != nil {
+			return fmt.Errorf("failed to write result to %s: %v", path, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgconn"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryableSQLStates are the SQLSTATE codes of transient errors after
+// which a query is worth retrying, eg- during a failover.
+var retryableSQLStates = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// retryPolicy determines whether & when a failed query is retried.
+// The zero value never retries.
+type retryPolicy struct {
+	// MaxRetries is the max number of times a query is retried after its
+	// first attempt failed
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, doubled on every
+	// subsequent retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// isRetryable returns true if the error is transient, ie, the query may
+// succeed if it is run again. Timeouts & cancellations are never retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || isTimeout(err) {
+		return false
+	}
+	if code := sqlState(err); code != noSQLState {
+		// class 08 is connection exceptions
+		return retryableSQLStates[code] || strings.HasPrefix(code, "08")
+	}
+
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// backoff returns the delay before the given retry (starting at 1). The
+// delay grows exponentially and is jittered so that workers that failed
+// together don't retry in lockstep.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter: half the delay is fixed, the other half is random
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// run calls fn until it succeeds, fails with an error that is not
+// retryable or the retries are exhausted. It returns the number of
+// retries made along with the error of the last attempt, or the deadline
+// error if the deadline of ctx expired while backing off.
+func (p retryPolicy) run(ctx context.Context, fn func() error) (int, error) {
+	retries := 0
+	for {
+		err := fn()
+		if err == nil || retries >= p.MaxRetries || !isRetryable(err) {
+			return retries, err
+		}
+		retries++
+
+		t := time.NewTimer(p.backoff(retries))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return retries, ctx.Err()
+			}
+			// report the error of the query rather than the cancellation
+			return retries, err
+		case <-t.C:
+		}
+	}
+}
+
+// RetryCount is the number of queries that were retried a given number
+// of times.
+type RetryCount struct {
+	Retries int `json:"retries"`
+	Queries int `json:"queries"`
+}
+
+// RetryStats describe how often queries had to be retried.
+type RetryStats struct {
+	// RetriedQueries is the number of queries retried at least once, and
+	// TotalRetries is the number of retries across all queries
+	RetriedQueries int `json:"retried_queries"`
+	TotalRetries   int `json:"total_retries"`
+	// SucceededAfterRetry is the number of queries that only succeeded
+	// after being retried, the rest failed on their last retry
+	SucceededAfterRetry int `json:"succeeded_after_retry"`
+	FailedAfterRetry    int `json:"failed_after_retry"`
+	// Distribution counts the queries by their number of retries
+	Distribution []RetryCount `json:"distribution"`
+}
+
+// newRetryStats computes the retry stats of the results. It returns nil
+// if no query was retried.
+func newRetryStats(results []*Result) *RetryStats {
+	s := &RetryStats{}
+	counts := make(map[int]int)
+	for _, res := range results {
+		if res.Retries == 0 {
+			continue
+		}
+		s.RetriedQueries++
+		s.TotalRetries += res.Retries
+		if res.Err == nil {
+			s.SucceededAfterRetry++
+		} else {
+			s.FailedAfterRetry++
+		}
+		counts[res.Retries]++
+	}
+	if s.RetriedQueries == 0 {
+		return nil
+	}
+
+	s.Distribution = make([]RetryCount, 0, len(counts))
+	for retries, queries := range counts {
+		s.Distribution = append(s.Distribution, RetryCount{Retries: retries, Queries: queries})
+	}
+	sort.Slice(s.Distribution, func(i, j int) bool { return s.Distribution[i].Retries < s.Distribution[j].Retries })
+
+	return s
+}
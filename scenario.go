@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scenarioInputFlags are the flags whose values are paths to input files.
+// Relative paths in a scenario are resolved against the directory of the
+// scenario file, so that scenarios can be checked in along with their
+// query templates & params.
+var scenarioInputFlags = map[string]bool{
+	"qp":         true,
+	"query-file": true,
+	"query-dir":  true,
+	"baseline":   true,
+}
+
+// envVarRegex matches the references to environment variables that are
+// expanded in scenario settings, eg- ${DB_PASSWORD}
+var envVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// scenarioSettings holds the flags of the run command, which are the
+// settings a scenario can contain along with the persistent flags.
+var scenarioSettings = &cobra.Command{}
+
+func init() {
+	addRunFlags(scenarioSettings)
+}
+
+// Scenario is a reproducible benchmark definition read from a JSON file.
+// Every setting is named after the flag it sets, with dashes optionally
+// written as underscores, eg- "worker_count": 4. The sections only serve
+// to organize the settings: connection settings, one or more named
+// workloads & output settings.
+type Scenario struct {
+	Connection map[string]interface{} `json:"connection"`
+	Workloads  []*Workload            `json:"workloads"`
+	Output     map[string]interface{} `json:"output"`
+
+	// dir is the directory of the scenario file
+	dir string
+}
+
+// Workload is a named set of settings of a scenario, eg- the query
+// template, query params, worker count, rate, duration & warmup.
+// Instead of a single query template, a workload can mix several
+// Queries, each with its own query params & weight.
+type Workload struct {
+	Name     string
+	Settings map[string]interface{}
+	Queries  []*QuerySpec
+}
+
+// UnmarshalJSON reads the name & queries of the workload along with its
+// settings
+func (w *Workload) UnmarshalJSON(b []byte) error {
+	if err := unmarshalSettings(b, &w.Settings); err != nil {
+		return err
+	}
+	name, ok := w.Settings["name"].(string)
+	if !ok || name == "" {
+		return errors.New("every workload must have a name")
+	}
+	w.Name = name
+	delete(w.Settings, "name")
+
+	queries, ok := w.Settings["queries"]
+	if !ok {
+		return nil
+	}
+	delete(w.Settings, "queries")
+	raw, err := json.Marshal(queries)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w.Queries); err != nil {
+		return fmt.Errorf("invalid queries of workload %s: %v", w.Name, err)
+	}
+	if len(w.Queries) == 0 {
+		return fmt.Errorf("workload %s has no queries", w.Name)
+	}
+	return nil
+}
+
+// unmarshalSettings decodes a JSON object, keeping numbers as they were
+// written so that they can be passed to flags verbatim.
+func unmarshalSettings(b []byte, dst *map[string]interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// loadScenario reads a scenario file
+func loadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario %s: %v", path, err)
+	}
+
+	s := &Scenario{dir: filepath.Dir(path)}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %v", path, err)
+	}
+
+	names := make(map[string]bool, len(s.Workloads))
+	for _, w := range s.Workloads {
+		if names[w.Name] {
+			return nil, fmt.Errorf("scenario %s has multiple workloads named %s", path, w.Name)
+		}
+		names[w.Name] = true
+
+		for _, q := range w.Queries {
+			for _, p := range []*string{&q.QueryFile, &q.QueryDir, &q.QueryParams} {
+				if *p != "" && *p != "-" && !filepath.IsAbs(*p) {
+					*p = filepath.Join(s.dir, *p)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// workload returns the workload with the given name. The name can be
+// omitted if the scenario has at most 1 workload.
+func (s *Scenario) workload(name string) (*Workload, error) {
+	if name == "" {
+		switch len(s.Workloads) {
+		case 0:
+			return &Workload{}, nil
+		case 1:
+			return s.Workloads[0], nil
+		}
+		return nil, fmt.Errorf("the scenario has multiple workloads, select one using --workload (available: %s)",
+			strings.Join(s.workloadNames(), ", "))
+	}
+
+	for _, w := range s.Workloads {
+		if w.Name == name {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("workload %s not found in the scenario (available: %s)", name, strings.Join(s.workloadNames(), ", "))
+}
+
+func (s *Scenario) workloadNames() []string {
+	names := make([]string, len(s.Workloads))
+	for i, w := range s.Workloads {
+		names[i] = w.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandEnv replaces the ${VAR} references in s with the values of the
+// environment variables. Other uses of $ are left as is, since they may
+// be part of a password or path.
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envVarRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envVarRegex.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// settingValue converts a setting to the string representation of a
+// flag value. Environment variables referenced as ${VAR} in strings are
+// expanded so that secrets need not be checked in, eg- "${DB_PASSWORD}".
+func settingValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return expandEnv(v)
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			s, err := settingValue(e)
+			if err != nil {
+				return "", err
+			}
+			values[i] = s
+		}
+		return strings.Join(values, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// apply sets the flags of cmd from the connection settings, the given
+// workload & the output settings, in that order. Flags supplied on the
+// command line take precedence over the scenario. Settings must be
+// flags of the run command, but settings that cmd has no flag for are
+// skipped, so that a scenario can be used with every command.
+func (s *Scenario) apply(cmd *cobra.Command, w *Workload) error {
+	// flags set on the command line, before any are set by the scenario
+	explicit := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) { explicit[f.Name] = true })
+
+	for _, section := range []struct {
+		name     string
+		settings map[string]interface{}
+	}{
+		{"connection", s.Connection}, {"workload " + w.Name, w.Settings}, {"output", s.Output},
+	} {
+		// sort the keys so that errors are deterministic
+		keys := make([]string, 0, len(section.settings))
+		for k := range section.settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			name := strings.ReplaceAll(k, "_", "-")
+			if scenarioSettings.Flags().Lookup(name) == nil && cmd.Root().PersistentFlags().Lookup(name) == nil {
+				return fmt.Errorf("unknown setting %s in the %s section of the scenario", k, section.name)
+			}
+			if explicit[name] || cmd.Flags().Lookup(name) == nil {
+				continue
+			}
+
+			value, err := settingValue(section.settings[k])
+			if err != nil {
+				return fmt.Errorf("invalid setting %s in the %s section of the scenario: %v", k, section.name, err)
+			}
+			if scenarioInputFlags[name] && value != "" && value != "-" && !filepath.IsAbs(value) {
+				value = filepath.Join(s.dir, value)
+			}
+			if err := cmd.Flags().Set(name, value); err != nil {
+				return fmt.Errorf("invalid setting %s in the %s section of the scenario: %v", k, section.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applyScenarioFromFlags loads the scenario supplied via --scenario, if
+// any, and applies the workload selected via --workload to cmd. It
+// returns the queries of the workload if it mixes several.
+func applyScenarioFromFlags(cmd *cobra.Command) ([]*QuerySpec, error) {
+	path, _ := cmd.Flags().GetString("scenario")
+	workload, _ := cmd.Flags().GetString("workload")
+	if path == "" {
+		if workload != "" {
+			return nil, errors.New("--workload requires a --scenario")
+		}
+		return nil, nil
+	}
+
+	s, err := loadScenario(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.workload(workload)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(cmd, w); err != nil {
+		return nil, err
+	}
+	return w.Queries, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/montanaflynn/stats"
+	"math"
+	"sort"
+)
+
+// defaultHistogramBuckets are the upper bounds (in ms) of the latency
+// histogram buckets. They grow roughly logarithmically so that both
+// sub-millisecond and multi-second queries land in meaningful buckets.
+var defaultHistogramBuckets = []float64{
+	0.5, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000,
+}
+
+// LatencyStats summarizes a set of query latencies (in ms).
+type LatencyStats struct {
+	Count  int     `json:"count"`
+	Sum    float64 `json:"sum_ms"`
+	Mean   float64 `json:"mean_ms"`
+	StdDev float64 `json:"stddev_ms"`
+	Min    float64 `json:"min_ms"`
+	Max    float64 `json:"max_ms"`
+	P50    float64 `json:"p50_ms"`
+	P90    float64 `json:"p90_ms"`
+	P95    float64 `json:"p95_ms"`
+	P99    float64 `json:"p99_ms"`
+	P999   float64 `json:"p99_9_ms"`
+}
+
+// newLatencyStats computes the summary stats for the given latencies.
+// It returns an error if no latencies are supplied.
+func newLatencyStats(latencies []float64) (*LatencyStats, error) {
+	if len(latencies) == 0 {
+		return nil, errors.New("no latencies to calculate stats for")
+	}
+
+	var err error
+	s := &LatencyStats{Count: len(latencies)}
+
+	if s.Sum, err = stats.Sum(latencies); err != nil {
+		return nil, fmt.Errorf("failed to calculate total query time: %v", err)
+	}
+	if s.Mean, err = stats.Mean(latencies); err != nil {
+		return nil, fmt.Errorf("failed to calculate average query time: %v", err)
+	}
+	if s.StdDev, err = stats.StandardDeviation(latencies); err != nil {
+		return nil, fmt.Errorf("failed to calculate standard deviation of query time: %v", err)
+	}
+	if s.Min, err = stats.Min(latencies); err != nil {
+		return nil, fmt.Errorf("failed to determine minimum query time: %v", err)
+	}
+	if s.Max, err = stats.Max(latencies); err != nil {
+		return nil, fmt.Errorf("failed to determine maximum query time: %v", err)
+	}
+
+	// sort once & look up every percentile in the sorted copy
+	sorted := append([]float64(nil), latencies...)
+	sort.Float64s(sorted)
+
+	percentiles := []struct {
+		p   float64
+		dst *float64
+	}{
+		{50, &s.P50}, {90, &s.P90}, {95, &s.P95}, {99, &s.P99}, {99.9, &s.P999},
+	}
+	for _, pc := range percentiles {
+		*pc.dst = nearestRank(sorted, pc.p)
+	}
+
+	return s, nil
+}
+
+// nearestRank returns the p-th percentile (0 < p <= 100) of a non-empty
+// sorted slice using the nearest rank method, like
+// stats.PercentileNearestRank but without sorting a copy of the slice.
+func nearestRank(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(float64(len(sorted)) * p / 100))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// HistogramBucket counts the latencies that fall in [LowerMs, UpperMs).
+// The last bucket of a histogram has no upper bound, indicated by
+// UpperMs being 0.
+type HistogramBucket struct {
+	LowerMs float64 `json:"lower_ms"`
+	UpperMs float64 `json:"upper_ms"`
+	Count   int     `json:"count"`
+}
+
+// Label returns a human-readable range of the bucket, eg- "1 - 2"
+func (b HistogramBucket) Label() string {
+	if b.UpperMs == 0 {
+		return fmt.Sprintf(">= %g", b.LowerMs)
+	}
+	return fmt.Sprintf("%g - %g", b.LowerMs, b.UpperMs)
+}
+
+// newHistogram distributes the latencies into buckets delimited by the
+// given upper bounds, which must be in increasing order. An additional
+// bucket is added for latencies beyond the last bound.
+func newHistogram(latencies, bounds []float64) ([]HistogramBucket, error) {
+	if len(bounds) == 0 {
+		return nil, errors.New("at least 1 histogram bucket boundary is required")
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return nil, fmt.Errorf("histogram bucket boundaries must be strictly increasing, got %v", bounds)
+		}
+	}
+
+	buckets := make([]HistogramBucket, len(bounds)+1)
+	lower := 0.0
+	for i, b := range bounds {
+		buckets[i] = HistogramBucket{LowerMs: lower, UpperMs: b}
+		lower = b
+	}
+	buckets[len(bounds)] = HistogramBucket{LowerMs: lower}
+
+	for _, l := range latencies {
+		// index of the first bound greater than the latency
+		i := sort.Search(len(bounds), func(i int) bool { return bounds[i] > l })
+		buckets[i].Count++
+	}
+
+	return buckets, nil
+}
+
+// GroupStats summarizes the results of a group of queries, eg- all
+// queries run for a specific host.
+type GroupStats struct {
+	Name         string        `json:"name"`
+	Queries      int           `json:"queries"`
+	FailureCount int           `json:"failure_count"`
+	Latency      *LatencyStats `json:"latency,omitempty"`
+}
+
+// newGroupStats groups the results by the key returned by keyFn and
+// computes stats of the latencies returned by latencyFn for each group.
+// Groups are sorted by their p99 latency in descending order so that the
+// worst offenders come first.
+func newGroupStats(results []*Result, keyFn func(*Result) string, latencyFn func(*Result) float64) ([]*GroupStats, error) {
+	groups := make(map[string]*GroupStats)
+	latencies := make(map[string][]float64)
+
+	for _, res := range results {
+		k := keyFn(res)
+		g, ok := groups[k]
+		if !ok {
+			g = &GroupStats{Name: k}
+			groups[k] = g
+		}
+		g.Queries++
+		if res.Err != nil {
+			g.FailureCount++
+			continue
+		}
+		latencies[k] = append(latencies[k], latencyFn(res))
+	}
+
+	sorted := make([]*GroupStats, 0, len(groups))
+	for k, g := range groups {
+		if len(latencies[k]) > 0 {
+			var err error
+			if g.Latency, err = newLatencyStats(latencies[k]); err != nil {
+				return nil, fmt.Errorf("failed to calculate stats for %s: %v", k, err)
+			}
+		}
+		sorted = append(sorted, g)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		pi, pj := sorted[i].p99(), sorted[j].p99()
+		if pi != pj {
+			return pi > pj
+		}
+		if sorted[i].FailureCount != sorted[j].FailureCount {
+			return sorted[i].FailureCount > sorted[j].FailureCount
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted, nil
+}
+
+func (g *GroupStats) p99() float64 {
+	if g.Latency == nil {
+		return 0
+	}
+	return g.Latency.P99
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimelineWindow contains the stats of the queries that completed within
+// a window of time of the run.
+type TimelineWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// OffsetSec is the start of the window relative to the start of the run
+	OffsetSec  float64 `json:"offset_sec"`
+	Queries    int     `json:"queries"`
+	Failures   int     `json:"failures"`
+	Throughput float64 `json:"throughput_qps"`
+	// Latency is nil if no query succeeded within the window
+	Latency *LatencyStats `json:"latency,omitempty"`
+}
+
+// newTimeline splits the run into consecutive windows of the given length,
+// starting at the start of the first query, and computes the stats of the
+// queries that completed in each. Windows in which no query completed are
+// included so that stalls show up in the timeline.
+func newTimeline(results []*Result, interval time.Duration, latencyFn func(*Result) float64) ([]*TimelineWindow, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	var first, last time.Time
+	for _, res := range results {
+		if first.IsZero() || res.StartTime.Before(first) {
+			first = res.StartTime
+		}
+		if res.EndTime.After(last) {
+			last = res.EndTime
+		}
+	}
+
+	windows := make([]*TimelineWindow, int(last.Sub(first)/interval)+1)
+	latencies := make([][]float64, len(windows))
+	for i := range windows {
+		start := first.Add(time.Duration(i) * interval)
+		windows[i] = &TimelineWindow{Start: start, End: start.Add(interval), OffsetSec: (time.Duration(i) * interval).Seconds()}
+	}
+
+	for _, res := range results {
+		i := int(res.EndTime.Sub(first) / interval)
+		w := windows[i]
+		w.Queries++
+		if res.Err != nil {
+			w.Failures++
+			continue
+		}
+		latencies[i] = append(latencies[i], latencyFn(res))
+	}
+
+	for i, w := range windows {
+		w.Throughput = float64(w.Queries) / interval.Seconds()
+		if len(latencies[i]) == 0 {
+			continue
+		}
+		var err error
+		if w.Latency, err = newLatencyStats(latencies[i]); err != nil {
+			return nil, fmt.Errorf("failed to calculate stats of window at %s: %v", w.Start.Format(time.RFC3339), err)
+		}
+	}
+
+	return windows, nil
+}
+
+// writeTimeline writes the timeline to a file, as a JSON array if the
+// file has a .json extension & as CSV otherwise.
+func writeTimeline(path string, windows []*TimelineWindow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(windows); err != nil {
+			return fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	header := []string{"start", "end", "offset_sec", "queries", "failures", "throughput_qps"}
+	latencyCols := latencyMetrics("", &LatencyStats{})
+	for _, m := range latencyCols {
+		header = append(header, m.name)
+	}
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write header to %s: %v", path, err)
+	}
+
+	for _, tw := range windows {
+		rec := []string{
+			tw.Start.Format(time.RFC3339Nano),
+			tw.End.Format(time.RFC3339Nano),
+			formatFloat(tw.OffsetSec),
+			strconv.Itoa(tw.Queries),
+			strconv.Itoa(tw.Failures),
+			formatFloat(tw.Throughput),
+		}
+		if tw.Latency != nil {
+			for _, m := range latencyMetrics("", tw.Latency) {
+				rec = append(rec, m.value)
+			}
+		} else {
+			// leave the latency columns empty if no query succeeded
+			rec = append(rec, make([]string, len(latencyCols))...)
+		}
+		if err := w.Write(rec); err != nil {
+			return fmt.Errorf("failed to write timeline window to %s: %v", path, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import "time"
+
+// WorkerUtilization describes how busy a worker was during the run
+type WorkerUtilization struct {
+	Worker  int `json:"worker"`
+	Queries int `json:"queries"`
+	// BusySec is the time the worker spent executing jobs & Utilization
+	// is the fraction of the run window that it was busy for
+	BusySec     float64 `json:"busy_sec"`
+	Utilization float64 `json:"utilization"`
+}
+
+// UtilizationStats describe how evenly jobs were spread across workers
+// by the routing strategy of the worker pool.
+type UtilizationStats struct {
+	Routing string  `json:"routing"`
+	Mean    float64 `json:"mean"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	// Workers contains the utilization of every worker, including the
+	// ones that never received a job, only if requested
+	Workers []*WorkerUtilization `json:"workers,omitempty"`
+}
+
+// newUtilizationStats computes the utilization of the given number of
+// workers over the run window from the results they returned. The
+// utilization of every worker is only kept if perWorker is true, since
+// there can be thousands of workers.
+func newUtilizationStats(results []*Result, workerCount int, routing string, window time.Duration, perWorker bool) *UtilizationStats {
+	if workerCount < 1 {
+		return nil
+	}
+
+	s := &UtilizationStats{Routing: routing, Workers: make([]*WorkerUtilization, workerCount)}
+	busy := make([]time.Duration, workerCount)
+	for i := range s.Workers {
+		s.Workers[i] = &WorkerUtilization{Worker: i}
+	}
+	for _, res := range results {
+		if res.WorkerID < 0 || res.WorkerID >= workerCount {
+			continue
+		}
+		s.Workers[res.WorkerID].Queries++
+		busy[res.WorkerID] += res.EndTime.Sub(res.StartTime)
+	}
+
+	total := 0.0
+	for i, w := range s.Workers {
+		w.BusySec = busy[i].Seconds()
+		if window > 0 {
+			w.Utilization = w.BusySec / window.Seconds()
+		}
+		total += w.Utilization
+		if i == 0 || w.Utilization < s.Min {
+			s.Min = w.Utilization
+		}
+		if w.Utilization > s.Max {
+			s.Max = w.Utilization
+		}
+	}
+	s.Mean = total / float64(workerCount)
+	if !perWorker {
+		s.Workers = nil
+	}
+
+	return s
+}
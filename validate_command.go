@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var validateCommand = &cobra.Command{
+	Use:     "validate --qp FILE",
+	Short:   "Check a query template & query params without running a benchmark",
+	Args:    cobra.NoArgs,
+	RunE:    validateHandler,
+	Example: "selectosaur validate --qp /tmp/query_params.csv --query-file cpu.sql",
+	Long: `
+    Validate checks that the query template can be loaded, that the query
+    params CSV has all the columns required by the template and that every
+    record can be parsed.
+
+    Unless --offline is passed, it also connects to the database, prepares
+    the query and plans it (without running it) for the first query param,
+    which catches syntax errors, missing tables & parameter type mismatches.`,
+}
+
+func init() {
+	addQueryFlags(validateCommand)
+	validateCommand.Flags().Bool("offline", false, "Skip the checks that require a database connection")
+
+	command.AddCommand(validateCommand)
+}
+
+func validateHandler(cmd *cobra.Command, args []string) error {
+	mix, err := applyScenarioFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	queries, err := queryTypesFromFlags(cmd, mix)
+	if err != nil {
+		return err
+	}
+	for _, q := range queries {
+		fmt.Fprintf(os.Stderr, "OK  query template %s binds columns: %v\n", q.Template.Name, q.Template.Params)
+		hosts := make(map[string]bool)
+		for _, qp := range q.Params {
+			hosts[qp.Hostname] = true
+		}
+		fmt.Fprintf(os.Stderr, "OK  %d query params for %d hosts\n", len(q.Params), len(hosts))
+	}
+
+	if offline, _ := cmd.Flags().GetBool("offline"); offline {
+		return nil
+	}
+
+	connStr, err := connectionString(cmd)
+	if err != nil {
+		return err
+	}
+	dbPool, err := pgxpool.Connect(cmd.Context(), connStr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to timescale database: %v", err)
+	}
+	defer dbPool.Close()
+	fmt.Fprintln(os.Stderr, "OK  connected to the database")
+
+	conn, err := dbPool.Acquire(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to acquire a database connection: %v", err)
+	}
+	defer conn.Release()
+
+	for _, q := range queries {
+		tmpl, qp := q.Template, q.Params[0]
+		if _, err := conn.Conn().Prepare(cmd.Context(), tmpl.Name, tmpl.SQL); err != nil {
+			return fmt.Errorf("failed to prepare query template %s: %v", tmpl.Name, err)
+		}
+		fmt.Fprintf(os.Stderr, "OK  query template %s prepared\n", tmpl.Name)
+
+		var plan []byte
+		err = conn.QueryRow(cmd.Context(), explainOptions{}.statementPrefix(false, "JSON")+tmpl.SQL, tmpl.Args(qp)...).Scan(&plan)
+		if err != nil {
+			return fmt.Errorf("failed to plan query %s for %s: %v", tmpl.Name, qp, err)
+		}
+		fmt.Fprintf(os.Stderr, "OK  query %s planned for %s\n", tmpl.Name, qp)
+	}
+
+	return nil
+}
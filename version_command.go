@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is set at build time, eg-
+// go build -ldflags "-X main.version=v1.2.0"
+var version = "dev"
+
+var versionCommand = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of selectosaur",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		v := version
+		if info, ok := debug.ReadBuildInfo(); ok && v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			// installed via go install
+			v = info.Main.Version
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "selectosaur %s (%s, %s/%s)\n", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	},
+}
+
+func init() {
+	command.AddCommand(versionCommand)
+}
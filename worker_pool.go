@@ -2,86 +2,201 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
 )
 
 const maxWorkers = 10000
 
+// Strategies with which the WorkerPool routes jobs to its workers
+const (
+	// routeHash sends all jobs of a host to the same worker, so queries
+	// for a host never run concurrently
+	routeHash = "hash"
+	// routeRoundRobin sends jobs to each worker in turn
+	routeRoundRobin = "round-robin"
+	// routeLeastBusy has all workers take jobs from a shared queue, so a
+	// job is picked up by whichever worker is free first
+	routeLeastBusy = "least-busy"
+	// routeRandom sends every job to a randomly chosen worker
+	routeRandom = "random"
+)
+
+var routingStrategies = []string{routeHash, routeRoundRobin, routeLeastBusy, routeRandom}
+
+// validateRoutingStrategy returns an error if the given routing strategy
+// is unknown
+func validateRoutingStrategy(routing string) error {
+	for _, r := range routingStrategies {
+		if r == routing {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported routing strategy %s, must be one of: %s", routing, strings.Join(routingStrategies, ", "))
+}
+
+// Job is a query param submitted to the WorkerPool for execution along
+// with the query template it is bound to.
+type Job struct {
+	*QueryParameter
+	Template *QueryTemplate
+	// IntendedStart is the time at which the job was scheduled to start,
+	// only set in open-loop (constant arrival rate) mode.
+	IntendedStart time.Time
+	// Warmup is true for jobs whose results are excluded from the stats
+	Warmup bool
+	// DispatchedAt is the time at which the pool routed the job to a worker
+	DispatchedAt time.Time
+}
+
 // Result contains the net output of a job executed by a Worker.
 type Result struct {
-	Job        *QueryParameter
-	Err        error
+	Job      *Job
+	WorkerID int
+	Err      error
+	// StartTime & EndTime are the times at which the Worker started &
+	// finished executing the job
+	StartTime  time.Time
+	EndTime    time.Time
+	PlanTimeMs float64
 	ExecTimeMs float64
+	// ClientTimeMs is the wall-clock time of the query as observed by
+	// selectosaur, only measured in client & both timing modes.
+	ClientTimeMs float64
+	// Plan summarizes the EXPLAIN plan of the query, not available in
+	// client timing mode. RawPlan is only retained for the sampled plans
+	// of the slowest queries, if plans are captured.
+	Plan    *PlanSummary
+	RawPlan json.RawMessage
+	// IO is only available if EXPLAIN reports buffer or WAL usage
+	IO *IOStats
+	// Retries is the number of times the query was retried after failing
+	// with a transient error
+	Retries int
+}
+
+// TotalTimeMs returns the total processing time of the query, ie, the
+// sum of its Planning time & Execution time.
+func (r *Result) TotalTimeMs() float64 {
+	return r.PlanTimeMs + r.ExecTimeMs
 }
 
 type Worker struct {
 	id       int
-	jobCh    chan *QueryParameter
+	jobCh    chan *Job
 	resultsQ chan *Result
 	db       *Datastore
 }
 
 func (w *Worker) Start(ctx context.Context) {
-	for qp := range w.jobCh {
-		t, err := w.db.CPUStatsQueryExecTime(ctx, qp)
-		r := &Result{
-			Job: qp, Err: err, ExecTimeMs: t,
+	for job := range w.jobCh {
+		r := &Result{Job: job, WorkerID: w.id, StartTime: time.Now()}
+		if r.Err = ctx.Err(); r.Err == nil {
+			// don't bother running queries once the run is cancelled
+			r.Err = w.db.Measure(ctx, job.Template, job.QueryParameter, r)
 		}
+		r.EndTime = time.Now()
 		w.resultsQ <- r
 	}
 }
 
 // WorkerPool manages a pool of workers to perform multiple timescale query
-//execution jobs concurrently.
+// execution jobs concurrently.
 // It guarantees that for every job submitted, there will be exactly 1 Result
 // returned via its results channel.
+// Once the job queue channel is closed and all submitted jobs have been
+// executed, all workers exit and the pool closes its results channel.
 type WorkerPool struct {
-	count   int
-	workers []*Worker
-	jobsQ   chan *QueryParameter
-}
-
-// Close ensures all workers in the pool exit and free up all resources.
-// This method must be called after closing the Job queue channel of
-// the pool.
-func (wp *WorkerPool) Close() {
-	// close all workers' job channels so they can exit
-	for _, w := range wp.workers {
-		close(w.jobCh)
-	}
+	count    int
+	routing  string
+	workers  []*Worker
+	jobsQ    chan *Job
+	resultsQ chan *Result
+	wg       sync.WaitGroup
+	rng      *rand.Rand
 }
 
 func (wp *WorkerPool) start() {
-	for qp := range wp.jobsQ {
+	next := 0
+	for job := range wp.jobsQ {
 		// map the query parameter to the right worker
-		wid := qp.HostID % wp.count
-		wp.workers[wid].jobCh <- qp
+		var wid int
+		switch wp.routing {
+		case routeRoundRobin:
+			wid = next
+			next = (next + 1) % wp.count
+		case routeRandom:
+			wid = wp.rng.Intn(wp.count)
+		case routeLeastBusy:
+			// all workers share the same job channel
+			wid = 0
+		default:
+			wid = job.HostID % wp.count
+		}
+		job.DispatchedAt = time.Now()
+		wp.workers[wid].jobCh <- job
 	}
+
+	// close all workers' job channels so they can exit
+	if wp.routing == routeLeastBusy {
+		close(wp.workers[0].jobCh)
+	} else {
+		for _, w := range wp.workers {
+			close(w.jobCh)
+		}
+	}
+	wp.wg.Wait()
+	close(wp.resultsQ)
 }
 
 func newWorkerPool(
 	ctx context.Context,
 	count int,
+	routing string,
 	db *Datastore,
-	jobsQ chan *QueryParameter,
+	jobsQ chan *Job,
 	resultsQ chan *Result,
 ) (*WorkerPool, error) {
 	if count < 1 || count > maxWorkers {
 		return nil, fmt.Errorf("worker count should be between 1 and %d", maxWorkers)
 	}
 
+	if err := validateRoutingStrategy(routing); err != nil {
+		return nil, err
+	}
+
+	p := &WorkerPool{
+		count:    count,
+		routing:  routing,
+		jobsQ:    jobsQ,
+		resultsQ: resultsQ,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	sharedCh := make(chan *Job)
 	w := make([]*Worker, count, count)
+	p.wg.Add(count)
 	for i := 0; i < count; i++ {
 		w[i] = &Worker{
 			id:       i,
 			db:       db,
-			jobCh:    make(chan *QueryParameter),
+			jobCh:    make(chan *Job),
 			resultsQ: resultsQ,
 		}
-		go w[i].Start(ctx)
+		if routing == routeLeastBusy {
+			w[i].jobCh = sharedCh
+		}
+		go func(w *Worker) {
+			defer p.wg.Done()
+			w.Start(ctx)
+		}(w[i])
 	}
 
-	p := &WorkerPool{count: count, jobsQ: jobsQ, workers: w}
+	p.workers = w
 	go p.start()
 
 	return p, nil